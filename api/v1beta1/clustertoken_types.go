@@ -0,0 +1,91 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TokenTemplateMetadata is the metadata added to the Tokens of a ClusterToken
+type TokenTemplateMetadata struct {
+	// Labels added to the tokens
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the tokens
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// TokenTemplateSpec describes the Tokens created by a ClusterToken
+type TokenTemplateSpec struct {
+	// Metadata added to the tokens
+	Metadata TokenTemplateMetadata `json:"metadata,omitempty"`
+	// Spec of the tokens
+	Spec TokenSpec `json:"spec,omitempty"`
+}
+
+// ClusterTokenSpec defines the desired state of ClusterToken
+type ClusterTokenSpec struct {
+	// NamespaceSelector selects the namespaces a token is created in
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// Template describes the tokens created in the selected namespaces
+	Template TokenTemplateSpec `json:"template"`
+}
+
+// ClusterTokenStatus defines the observed state of ClusterToken
+type ClusterTokenStatus struct {
+	// ObservedGeneration is the generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Tokens is the number of tokens created for the cluster token
+	Tokens int32 `json:"tokens,omitempty"`
+	// ReadyTokens is the number of tokens that are ready
+	ReadyTokens int32 `json:"readyTokens,omitempty"`
+	// NotReadyNamespaces lists the namespaces whose token is not ready
+	NotReadyNamespaces []string `json:"notReadyNamespaces,omitempty"`
+	// FailedNamespaces lists the namespaces whose token could not be
+	// created or updated
+	FailedNamespaces []string `json:"failedNamespaces,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Tokens",type="integer",JSONPath=".status.tokens",description="Number of tokens"
+//+kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyTokens",description="Number of ready tokens"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterToken is the Schema for the clustertokens API
+type ClusterToken struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterTokenSpec   `json:"spec,omitempty"`
+	Status ClusterTokenStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterTokenList contains a list of ClusterToken
+type ClusterTokenList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterToken `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterToken{}, &ClusterTokenList{})
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var clustertokenlog = logf.Log.WithName("clustertoken-resource")
+
+// validateClusterTokenPath is the path the validating webhook of cluster
+// tokens is served at
+const validateClusterTokenPath = "/validate-serviceaccount-kubetrail-io-v1beta1-clustertoken"
+
+func (r *ClusterToken) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// cluster tokens are validated by a handler that has access to the
+	// requesting user, since the operator creates their tokens on its behalf
+	mgr.GetWebhookServer().Register(validateClusterTokenPath, &webhook.Admission{
+		Handler: &clusterTokenValidator{client: mgr.GetClient()},
+	})
+
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-serviceaccount-kubetrail-io-v1beta1-clustertoken,mutating=false,failurePolicy=fail,sideEffects=None,groups=serviceaccount.kubetrail.io,resources=clustertokens,verbs=create;update,versions=v1beta1,name=vclustertoken.kb.io,admissionReviewVersions=v1
+
+// validateSpec validates the namespace selector and the token template
+func (r *ClusterToken) validateSpec() error {
+	if _, err := metav1.LabelSelectorAsSelector(&r.Spec.NamespaceSelector); err != nil {
+		return fmt.Errorf("namespace selector is invalid: %w", err)
+	}
+
+	// copies could leak tokens of a namespace into namespaces the requester
+	// has not been authorized for
+	if r.Spec.Template.Spec.ReplicateTo != nil {
+		return fmt.Errorf("replicate to is not supported in cluster token templates")
+	}
+
+	token := &Token{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        r.Name,
+			Labels:      r.Spec.Template.Metadata.Labels,
+			Annotations: r.Spec.Template.Metadata.Annotations,
+		},
+		Spec: *r.Spec.Template.Spec.DeepCopy(),
+	}
+	token.Default()
+	if err := token.validateAnnotations(); err != nil {
+		return err
+	}
+	if err := token.validateSpec(); err != nil {
+		return fmt.Errorf("template is invalid: %w", err)
+	}
+
+	return nil
+}
+
+// clusterTokenValidator validates cluster tokens and checks that the
+// requesting user is allowed to obtain tokens for the service account of the
+// template in all namespaces
+type clusterTokenValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &clusterTokenValidator{}
+var _ admission.DecoderInjector = &clusterTokenValidator{}
+
+// InjectDecoder injects the decoder into the validator
+func (v *clusterTokenValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle handles admission requests for cluster tokens
+func (v *clusterTokenValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	object := &ClusterToken{}
+
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := v.decoder.Decode(req, object); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	case admissionv1.Update:
+		old := &ClusterToken{}
+		if err := v.decoder.DecodeRaw(req.Object, object); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// metadata of cluster tokens being deleted or left unchanged is
+		// updated by the operator
+		if object.DeletionTimestamp != nil || equality.Semantic.DeepEqual(old.Spec, object.Spec) {
+			return admission.Allowed("")
+		}
+	default:
+		return admission.Allowed("")
+	}
+
+	clustertokenlog.Info("validate", "name", object.Name, "operation", req.Operation)
+
+	if err := object.validateSpec(); err != nil {
+		clustertokenlog.Error(err, "invalid cluster token", "name", object.Name)
+		return admission.Denied(err.Error())
+	}
+
+	if err := v.authorize(ctx, req.UserInfo, object); err != nil {
+		clustertokenlog.Error(err, "requester is not allowed to use service account", "name", object.Name)
+		return admission.Denied(err.Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// authorize checks that the user is allowed to obtain tokens for the service
+// account of the template in all namespaces. Namespaces may be created or
+// labeled after admission and are then given a token without another check,
+// so access to the currently selected namespaces is not sufficient.
+func (v *clusterTokenValidator) authorize(ctx context.Context, userInfo authenticationv1.UserInfo, object *ClusterToken) error {
+	serviceAccountName := object.Spec.Template.Spec.ServiceAccountName
+	if len(serviceAccountName) == 0 {
+		serviceAccountName = "default"
+	}
+
+	allowed, err := authorizeServiceAccount(ctx, v.client, userInfo, "", serviceAccountName)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return fmt.Errorf(
+			"user %s is not allowed to create serviceaccounts/token or %s serviceaccounts for service account %s in all namespaces",
+			userInfo.Username,
+			verbUse,
+			serviceAccountName,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// validatePath is the path the validating webhook of tokens is served at
+const validatePath = "/validate-serviceaccount-kubetrail-io-v1beta1-token"
+
+// verbUse is the verb on a service account that allows requesting tokens for
+// it through the operator without being allowed to create tokens directly
+const verbUse = "use"
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// tokenValidator validates tokens like the Validator implementation of Token
+// and additionally checks that the requesting user is allowed to obtain
+// tokens for the service account and to create the secrets the token is
+// copied to, which the Validator interface has no access to the request for
+type tokenValidator struct {
+	client  client.Client
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &tokenValidator{}
+var _ admission.DecoderInjector = &tokenValidator{}
+
+// InjectDecoder injects the decoder into the validator
+func (v *tokenValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle handles admission requests for tokens
+func (v *tokenValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	object := &Token{}
+
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := v.decoder.Decode(req, object); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := object.ValidateCreate(); err != nil {
+			return admission.Denied(err.Error())
+		}
+	case admissionv1.Update:
+		old := &Token{}
+		if err := v.decoder.DecodeRaw(req.Object, object); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := object.ValidateUpdate(old); err != nil {
+			return admission.Denied(err.Error())
+		}
+		// the requester was authorized when the fields deciding who obtains
+		// the token were set
+		if !authorizedSpecChanged(&old.Spec, &object.Spec) {
+			return admission.Allowed("")
+		}
+	default:
+		return admission.Allowed("")
+	}
+
+	if err := v.authorize(ctx, req.UserInfo, object); err != nil {
+		tokenlog.Error(err, "requester is not allowed to use service account", "name", object.Name)
+		return admission.Denied(err.Error())
+	}
+
+	if err := v.authorizeReplicas(ctx, req.UserInfo, object); err != nil {
+		tokenlog.Error(err, "requester is not allowed to replicate token", "name", object.Name)
+		return admission.Denied(err.Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// authorizedSpecChanged checks if the update changes the service account of
+// the token or where the token is written to or usable for, which allows
+// obtaining the token and is authorized like setting the service account
+func authorizedSpecChanged(old, new *TokenSpec) bool {
+	return old.ServiceAccountName != new.ServiceAccountName ||
+		!equality.Semantic.DeepEqual(old.ReplicateTo, new.ReplicateTo) ||
+		!equality.Semantic.DeepEqual(old.Target, new.Target) ||
+		!equality.Semantic.DeepEqual(old.Output, new.Output) ||
+		!equality.Semantic.DeepEqual(old.Audiences, new.Audiences) ||
+		!equality.Semantic.DeepEqual(old.BoundObjectRef, new.BoundObjectRef)
+}
+
+// authorize checks that the user is allowed to create tokens for the service
+// account of the token, or to use the service account through the operator
+func (v *tokenValidator) authorize(ctx context.Context, userInfo authenticationv1.UserInfo, object *Token) error {
+	allowed, err := authorizeServiceAccount(ctx, v.client, userInfo, object.Namespace, object.Spec.ServiceAccountName)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return fmt.Errorf(
+			"user %s is not allowed to create serviceaccounts/token or %s serviceaccounts for service account %s in namespace %s",
+			userInfo.Username,
+			verbUse,
+			object.Spec.ServiceAccountName,
+			object.Namespace,
+		)
+	}
+
+	return nil
+}
+
+// authorizeReplicas checks that the user is allowed to create secrets in the
+// namespaces the token is copied to. Namespaces matched by a selector may be
+// created or labeled after admission, so a selector requires the user to be
+// allowed to create secrets in all namespaces.
+func (v *tokenValidator) authorizeReplicas(ctx context.Context, userInfo authenticationv1.UserInfo, object *Token) error {
+	replicateTo := object.Spec.ReplicateTo
+	if replicateTo == nil {
+		return nil
+	}
+
+	if replicateTo.NamespaceSelector != nil {
+		allowed, err := accessAllowed(ctx, v.client, userInfo, authorizationv1.ResourceAttributes{
+			Verb:     "create",
+			Resource: "secrets",
+		})
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf(
+				"user %s is not allowed to create secrets in all namespaces, which replicating to a namespace selector requires",
+				userInfo.Username,
+			)
+		}
+	}
+
+	var denied []string
+	for _, namespace := range replicateTo.Namespaces {
+		allowed, err := accessAllowed(ctx, v.client, userInfo, authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      "create",
+			Resource:  "secrets",
+		})
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			denied = append(denied, namespace)
+		}
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf(
+			"user %s is not allowed to create secrets in namespaces %s",
+			userInfo.Username,
+			strings.Join(denied, ", "),
+		)
+	}
+
+	return nil
+}
+
+// authorizeServiceAccount checks with subject access reviews that the user is
+// allowed to create tokens for the service account, or to use it through the
+// operator. An empty namespace checks for access in all namespaces.
+func authorizeServiceAccount(
+	ctx context.Context,
+	c client.Client,
+	userInfo authenticationv1.UserInfo,
+	namespace, name string,
+) (bool, error) {
+	for _, attributes := range []authorizationv1.ResourceAttributes{
+		{
+			Namespace:   namespace,
+			Verb:        "create",
+			Resource:    "serviceaccounts",
+			Subresource: "token",
+			Name:        name,
+		},
+		{
+			Namespace: namespace,
+			Verb:      verbUse,
+			Resource:  "serviceaccounts",
+			Name:      name,
+		},
+	} {
+		allowed, err := accessAllowed(ctx, c, userInfo, attributes)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+
+	return false, nil
+}
+
+// accessAllowed checks with a subject access review that the user is
+// allowed to access the resource
+func accessAllowed(
+	ctx context.Context,
+	c client.Client,
+	userInfo authenticationv1.UserInfo,
+	attributes authorizationv1.ResourceAttributes,
+) (bool, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               userInfo.Username,
+			Groups:             userInfo.Groups,
+			UID:                userInfo.UID,
+			Extra:              make(map[string]authorizationv1.ExtraValue),
+		},
+	}
+	for key, value := range userInfo.Extra {
+		review.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	if err := c.Create(ctx, review); err != nil {
+		tokenlog.Error(err, "failed to create subject access review")
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// maxTemplateOutputBytes is the most a template may render to
+	maxTemplateOutputBytes = 256 * 1024
+	// templateTimeout is the longest a template may take to render
+	templateTimeout = time.Second
+)
+
+//+kubebuilder:object:generate=false
+
+// TemplateData is passed to output templates
+type TemplateData struct {
+	Token              string
+	CACert             string
+	Namespace          string
+	ServiceAccountName string
+	// Expiry is the time the token stops being usable, which is zero
+	// for tokens that do not expire
+	Expiry time.Time
+}
+
+// sampleTemplateData returns data resembling that of a token issued for the
+// object, which templates are rendered with when they are validated
+func sampleTemplateData(r *Token) TemplateData {
+	return TemplateData{
+		Token:              "eyJhbGciOiJSUzI1NiJ9.e30.c2lnbmF0dXJl",
+		CACert:             "-----BEGIN CERTIFICATE-----\nMIIBsample\n-----END CERTIFICATE-----\n",
+		Namespace:          r.Namespace,
+		ServiceAccountName: r.Spec.ServiceAccountName,
+		Expiry:             time.Now().Add(time.Hour).UTC(),
+	}
+}
+
+// TemplateFuncMap returns the functions available to output templates. It is
+// shared by the webhook, which parses templates, and the controller, which
+// renders them.
+func TemplateFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"b64enc": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"b64dec": func(value string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			return string(decoded), err
+		},
+		"toJson": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+		"trim":  strings.TrimSpace,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+// ExecuteTemplate renders the template with the data. Templates are supplied
+// by users and rendered by the webhook and the controller, so rendering fails
+// once the output exceeds maxTemplateOutputBytes or templateTimeout passes.
+func ExecuteTemplate(tmpl *template.Template, data interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), templateTimeout)
+	defer cancel()
+
+	// the writer stops a template that keeps writing after the deadline,
+	// while one that is not writing is abandoned
+	writer := &limitedWriter{ctx: ctx, limit: maxTemplateOutputBytes}
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(writer, data)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return writer.buf.Bytes(), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("template did not render within %s", templateTimeout)
+	}
+}
+
+// limitedWriter buffers up to limit bytes until its context is done
+type limitedWriter struct {
+	ctx   context.Context
+	limit int
+	buf   bytes.Buffer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, fmt.Errorf("template output exceeds %d bytes", w.limit)
+	}
+	return w.buf.Write(p)
+}
+
+// ParseTemplate parses the output template written under the given key
+func ParseTemplate(key, text string) (*template.Template, error) {
+	return template.New(key).
+		Option("missingkey=error").
+		Funcs(TemplateFuncMap()).
+		Parse(text)
+}
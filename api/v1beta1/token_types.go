@@ -17,31 +17,299 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// TokenMode defines how service account tokens are issued
+// +kubebuilder:validation:Enum=tokenRequest;legacySecret
+type TokenMode string
+
+const (
+	// TokenModeTokenRequest issues bound, expiring tokens through the TokenRequest API
+	// and stores them in an operator owned Opaque secret
+	TokenModeTokenRequest TokenMode = "tokenRequest"
+	// TokenModeLegacySecret creates a kubernetes.io/service-account-token secret
+	// and relies on the kube token controller to populate it
+	TokenModeLegacySecret TokenMode = "legacySecret"
+)
+
+// BoundObjectReference is a reference to an object that a token is bound to.
+// The token is invalidated when the referenced object is deleted.
+type BoundObjectReference struct {
+	// Kind of the referent. Valid kinds are Pod and Secret.
+	Kind string `json:"kind,omitempty"`
+	// APIVersion of the referent
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Name of the referent in the namespace of the token
+	Name string `json:"name,omitempty"`
+	// UID of the referent
+	UID types.UID `json:"uid,omitempty"`
+}
+
+// DeletionPolicy defines what happens to issued secrets when a Token is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;Graceful
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes all issued secrets immediately
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain orphans all issued secrets
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyGraceful deletes all issued secrets once the newest one
+	// has outlived the deletion grace period following the deletion of the Token
+	DeletionPolicyGraceful DeletionPolicy = "Graceful"
+)
+
+const (
+	// AnnotationRotateAt requests a single rotation of the token once the
+	// RFC 3339 timestamp it holds has passed
+	AnnotationRotateAt = "serviceaccount.kubetrail.io/rotate-at"
+	// AnnotationRevokeAt requests a new token once the RFC 3339 timestamp it
+	// holds has passed, deleting all secrets issued before it without waiting
+	// for the deletion grace period
+	AnnotationRevokeAt = "serviceaccount.kubetrail.io/revoke-at"
+)
+
+// ServiceAccountTemplate describes the service account created for a Token
+type ServiceAccountTemplate struct {
+	// Labels added to the service account
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations added to the service account
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ImagePullSecrets of the service account
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// KubeconfigOutput describes a kubeconfig generated from the issued token
+type KubeconfigOutput struct {
+	// Server is the URL of the API server. Defaults to the API server URL
+	// the operator is configured with.
+	Server string `json:"server,omitempty"`
+	// ClusterName is the name of the cluster entry. Defaults to kubernetes.
+	ClusterName string `json:"clusterName,omitempty"`
+	// ContextName is the name of the context entry. Defaults to
+	// <serviceAccountName>@<clusterName>.
+	ContextName string `json:"contextName,omitempty"`
+	// SecretName is the name of a secret the kubeconfig is written to. The
+	// kubeconfig is written to the issued secrets when empty.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// TokenOutput describes additional formats the issued token is written in
+type TokenOutput struct {
+	// Kubeconfig writes a kubeconfig under the kubeconfig key
+	Kubeconfig *KubeconfigOutput `json:"kubeconfig,omitempty"`
+	// Templates maps secret keys to Go text templates rendered on every
+	// issuance. Templates are passed the Token, CACert, Namespace,
+	// ServiceAccountName and Expiry of the issued token and are written to
+	// the target secret if one is set, or else to the issued secrets.
+	Templates map[string]string `json:"templates,omitempty"`
+	// Type is the type of the target secret, such as
+	// kubernetes.io/dockerconfigjson for templates rendering image pull
+	// credentials. Requires a target and the keys the type requires to be
+	// rendered by templates. Defaults to Opaque.
+	Type corev1.SecretType `json:"type,omitempty"`
+}
+
+// TokenTarget describes a secret with a stable name that holds the current token
+type TokenTarget struct {
+	// SecretName is the name of the secret kept up to date with the data of
+	// the current token
+	SecretName string `json:"secretName"`
+}
+
+// ReplicationSpec describes the namespaces the current token is copied to
+type ReplicationSpec struct {
+	// Namespaces the current token is copied to
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects additional namespaces the current token is
+	// copied to
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// SecretName is the name of the copies. Defaults to the target secret
+	// name if set, or else to the name of the token.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// RotationStrategy defines how a newly issued token replaces the current one
+// +kubebuilder:validation:Enum=Immediate;Overlap;Verified
+type RotationStrategy string
+
+const (
+	// RotationStrategyImmediate deletes the previous secret as soon as the new
+	// token becomes current, regardless of the deletion grace period
+	RotationStrategyImmediate RotationStrategy = "Immediate"
+	// RotationStrategyOverlap keeps the previous secret for the deletion grace
+	// period after the new token becomes current
+	RotationStrategyOverlap RotationStrategy = "Overlap"
+	// RotationStrategyVerified validates the new token with a TokenReview
+	// before it becomes current and keeps the previous token in place while
+	// validation fails. The previous secret is then kept for the deletion
+	// grace period as with Overlap.
+	RotationStrategyVerified RotationStrategy = "Verified"
+)
+
+// MaintenanceWindow is a recurring period during which tokens may be rotated
+type MaintenanceWindow struct {
+	// Schedule is a cron expression for the start of the window, evaluated
+	// in the time zone of the rotation
+	Schedule string `json:"schedule"`
+	// DurationSeconds is the length of the window
+	// +kubebuilder:validation:Minimum=60
+	DurationSeconds int64 `json:"durationSeconds"`
+}
+
+// RotationSpec describes when tokens are rotated
+type RotationSpec struct {
+	// Schedule is a cron expression for the rotation of tokens, which replaces
+	// rotationPeriodSeconds. A token is rotated at the first activation of the
+	// schedule after it was issued.
+	Schedule string `json:"schedule,omitempty"`
+	// TimeZone is the IANA time zone the schedule and the maintenance windows
+	// are evaluated in. Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// MaintenanceWindows restrict rotations to the given windows. A rotation
+	// that is due outside a window waits for the next window.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// MaxTokenAgeSeconds is the age at which a token is rotated regardless
+	// of the maintenance windows
+	MaxTokenAgeSeconds *int64 `json:"maxTokenAgeSeconds,omitempty"`
+	// JitterPercent moves the rotation of every token earlier by up to the
+	// given percentage of its rotation interval, so that tokens created
+	// together do not rotate together. The offset is derived from the UID of
+	// the token and stays the same across restarts of the operator.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=50
+	JitterPercent int32 `json:"jitterPercent,omitempty"`
+	// Strategy defines how a newly issued token replaces the current one.
+	// Defaults to Overlap.
+	Strategy RotationStrategy `json:"strategy,omitempty"`
+}
+
 // TokenSpec defines the desired state of Token
 type TokenSpec struct {
 	ServiceAccountName         string `json:"serviceAccountName,omitempty"`
 	RotationPeriodSeconds      *int64 `json:"rotationPeriodSeconds,omitempty"`
 	DeletionGracePeriodSeconds *int64 `json:"deletionGracePeriodSeconds,omitempty"`
+	// Mode defines how tokens are issued. Objects without a mode are
+	// treated as legacySecret.
+	Mode TokenMode `json:"mode,omitempty"`
+	// Audiences are the intended audiences of the token. Defaults to the
+	// audiences of the API server when empty. Only used in tokenRequest mode.
+	Audiences []string `json:"audiences,omitempty"`
+	// BoundObjectRef is a reference to an object the token is bound to.
+	// Only used in tokenRequest mode.
+	BoundObjectRef *BoundObjectReference `json:"boundObjectRef,omitempty"`
+	// DeletionPolicy defines what happens to issued secrets when the token
+	// is deleted. Defaults to Delete.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// CreateServiceAccount creates the service account if it does not exist.
+	// The created service account is owned by the token.
+	CreateServiceAccount bool `json:"createServiceAccount,omitempty"`
+	// ServiceAccountTemplate describes the created service account. Only
+	// used with createServiceAccount.
+	ServiceAccountTemplate *ServiceAccountTemplate `json:"serviceAccountTemplate,omitempty"`
+	// Output describes additional formats the issued token is written in
+	Output *TokenOutput `json:"output,omitempty"`
+	// Target describes a secret with a stable name that holds the current token,
+	// which workloads can mount instead of the issued secrets
+	Target *TokenTarget `json:"target,omitempty"`
+	// ReplicateTo describes other namespaces the current token is copied to
+	ReplicateTo *ReplicationSpec `json:"replicateTo,omitempty"`
+	// Rotation describes a rotation schedule and the windows rotations are
+	// restricted to
+	Rotation *RotationSpec `json:"rotation,omitempty"`
+	// Suspend stops the issuance of new tokens, deferring rotations until the
+	// token is resumed. Secrets past their grace period are still deleted.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// SecretState describes where an issued secret is in its lifecycle
+type SecretState string
+
+const (
+	// SecretStateActive is the state of the secret holding the current token
+	SecretStateActive SecretState = "active"
+	// SecretStateRetiring is the state of a rotated secret within its grace period
+	SecretStateRetiring SecretState = "retiring"
+	// SecretStateExpired is the state of a secret whose token is no longer usable
+	SecretStateExpired SecretState = "expired"
+)
+
+// TokenSecretStatus describes a secret issued for a Token
+type TokenSecretStatus struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// State of the secret
+	// +kubebuilder:validation:Enum=active;retiring;expired
+	State SecretState `json:"state"`
+	// IssuedAt is the time the secret was created
+	IssuedAt metav1.Time `json:"issuedAt,omitempty"`
+	// RotatesAt is the time the secret is due for rotation
+	RotatesAt *metav1.Time `json:"rotatesAt,omitempty"`
+	// DeleteAt is the time the secret is deleted after its grace period
+	DeleteAt *metav1.Time `json:"deleteAt,omitempty"`
+	// Fingerprint is the SHA-256 hash of the token held in the secret
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// ReplicaStatus describes a copy of the current token in another namespace
+type ReplicaStatus struct {
+	// Namespace of the copy
+	Namespace string `json:"namespace"`
+	// Name of the copy
+	Name string `json:"name"`
 }
 
 // TokenStatus defines the observed state of Token
 type TokenStatus struct {
+	// ObservedGeneration is the generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	Phase      string             `json:"phase,omitempty"`
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	Message    string             `json:"message,omitempty"`
 	Reason     string             `json:"reason,omitempty"`
 	SecretName string             `json:"secretName,omitempty"`
+	// PendingSecretName is the name of a newly issued secret that is not yet
+	// populated with a token
+	PendingSecretName string `json:"pendingSecretName,omitempty"`
+	// PendingVerificationFailedAt is the time the pending token first failed
+	// verification. The token is discarded once it still fails after the
+	// provisioning timeout.
+	PendingVerificationFailedAt *metav1.Time `json:"pendingVerificationFailedAt,omitempty"`
+	// IssuedCount is the number of secrets issued for the token, from which
+	// the names of the secrets are derived
+	IssuedCount int64 `json:"issuedCount,omitempty"`
+	// Secrets lists the issued secrets along with recently expired ones
+	Secrets []TokenSecretStatus `json:"secrets,omitempty"`
+	// LastRotationTime is the time the current secret became active
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// NextRotationTime is the time the current secret is due for rotation
+	NextRotationTime *metav1.Time `json:"nextRotationTime,omitempty"`
+	// ServiceAccountUID is the UID of the service account the issued tokens
+	// belong to. Tokens are reissued when the service account is recreated.
+	ServiceAccountUID types.UID `json:"serviceAccountUID,omitempty"`
+	// Replicas lists the copies of the current token in other namespaces
+	Replicas []ReplicaStatus `json:"replicas,omitempty"`
+	// ObservedRotateAt is the time held by the rotate-at annotation when the
+	// rotation it requested was last handled
+	ObservedRotateAt *metav1.Time `json:"observedRotateAt,omitempty"`
+	// ObservedRevokeAt is the time held by the revoke-at annotation when the
+	// revocation it requested was last handled
+	ObservedRevokeAt *metav1.Time `json:"observedRevokeAt,omitempty"`
+	// LastRevocationTime is the time secrets were last revoked
+	LastRevocationTime *metav1.Time `json:"lastRevocationTime,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="Status of token"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready condition of token"
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // Token is the Schema for the tokens API
@@ -17,10 +17,21 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/kubetrail/serviceaccount-operator/internal/cron"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -28,7 +39,52 @@ import (
 // log is for logging in this package.
 var tokenlog = logf.Log.WithName("token-resource")
 
+// boundObjectKinds are the kinds the TokenRequest API can bind tokens to
+var boundObjectKinds = map[string]struct{}{
+	"Pod":    {},
+	"Secret": {},
+}
+
+// reservedTemplateKeys are the secret keys templates cannot be written to
+var reservedTemplateKeys = map[string]struct{}{
+	"token":      {},
+	"ca.crt":     {},
+	"namespace":  {},
+	"kubeconfig": {},
+}
+
+// outputSecretTypes are the secret types the target secret may have, along
+// with the keys the API server requires secrets of that type to hold. Basic
+// auth secrets require either of their keys.
+var outputSecretTypes = map[corev1.SecretType][]string{
+	corev1.SecretTypeOpaque:           nil,
+	corev1.SecretTypeDockerConfigJson: {corev1.DockerConfigJsonKey},
+	corev1.SecretTypeDockercfg:        {corev1.DockerConfigKey},
+	corev1.SecretTypeBasicAuth:        nil,
+	corev1.SecretTypeSSHAuth:          {corev1.SSHAuthPrivateKey},
+	corev1.SecretTypeTLS:              {corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+}
+
+// defaultRotationPeriodSeconds is used for tokenRequest mode tokens that
+// do not specify a rotation period, since such tokens always expire
+const defaultRotationPeriodSeconds int64 = 3600
+
+// defaultKubeconfigClusterName is the name of the cluster entry in generated
+// kubeconfigs that do not specify one
+const defaultKubeconfigClusterName = "kubernetes"
+
+// policyReader reads the token policies a token is validated against
+var policyReader client.Reader
+
 func (r *Token) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	policyReader = mgr.GetClient()
+
+	// the validating webhook is served by a handler that has access to the
+	// requesting user, the builder skips paths that are already registered
+	mgr.GetWebhookServer().Register(validatePath, &webhook.Admission{
+		Handler: &tokenValidator{client: mgr.GetClient()},
+	})
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -43,13 +99,73 @@ var _ webhook.Defaulter = &Token{}
 // Default implements webhook.Defaulter so a webhook will be registered for the type
 func (r *Token) Default() {
 	tokenlog.Info("default", "name", r.Name)
+	r.setDefaults(tokenlog)
+}
 
+// SetDefaults applies the defaults of the webhook without logging them, so
+// that tokens created by the operator can be compared with admitted ones
+func (r *Token) SetDefaults() {
+	r.setDefaults(logr.Discard())
+}
+
+// setDefaults applies the defaults of the webhook, logging each of them
+func (r *Token) setDefaults(logger logr.Logger) {
 	if len(r.Spec.ServiceAccountName) == 0 {
 		r.Spec.ServiceAccountName = "default"
-		tokenlog.Info("set service account name to", "name", r.Spec.ServiceAccountName)
+		logger.Info("set service account name to", "name", r.Spec.ServiceAccountName)
+	}
+
+	// new objects default to bound tokens, while existing objects
+	// without a mode keep using legacy secrets
+	if len(r.Spec.Mode) == 0 {
+		if r.CreationTimestamp.IsZero() {
+			r.Spec.Mode = TokenModeTokenRequest
+		} else {
+			r.Spec.Mode = TokenModeLegacySecret
+		}
+		logger.Info("set mode to", "mode", r.Spec.Mode)
+	}
+
+	if r.Spec.Mode == TokenModeTokenRequest && r.Spec.RotationPeriodSeconds == nil && !r.hasRotationSchedule() {
+		rotationPeriodSeconds := defaultRotationPeriodSeconds
+		r.Spec.RotationPeriodSeconds = &rotationPeriodSeconds
+		logger.Info("set rotation period seconds to", "seconds", rotationPeriodSeconds)
+	}
+
+	if len(r.Spec.DeletionPolicy) == 0 {
+		r.Spec.DeletionPolicy = DeletionPolicyDelete
+		logger.Info("set deletion policy to", "policy", r.Spec.DeletionPolicy)
+	}
+
+	if r.Spec.Output != nil && r.Spec.Output.Kubeconfig != nil {
+		kubeconfig := r.Spec.Output.Kubeconfig
+		if len(kubeconfig.ClusterName) == 0 {
+			kubeconfig.ClusterName = defaultKubeconfigClusterName
+			logger.Info("set kubeconfig cluster name to", "name", kubeconfig.ClusterName)
+		}
+		if len(kubeconfig.ContextName) == 0 {
+			kubeconfig.ContextName = fmt.Sprintf("%s@%s", r.Spec.ServiceAccountName, kubeconfig.ClusterName)
+			logger.Info("set kubeconfig context name to", "name", kubeconfig.ContextName)
+		}
+	}
+
+	if r.Spec.ReplicateTo != nil && len(r.Spec.ReplicateTo.SecretName) == 0 {
+		if r.Spec.Target != nil {
+			r.Spec.ReplicateTo.SecretName = r.Spec.Target.SecretName
+		} else {
+			r.Spec.ReplicateTo.SecretName = r.Name
+		}
+		logger.Info("set replica secret name to", "name", r.Spec.ReplicateTo.SecretName)
+	}
+
+	if r.Spec.BoundObjectRef != nil && len(r.Spec.BoundObjectRef.APIVersion) == 0 {
+		r.Spec.BoundObjectRef.APIVersion = "v1"
+		logger.Info("set bound object api version to", "apiVersion", r.Spec.BoundObjectRef.APIVersion)
 	}
 }
 
+//+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=tokenpolicies,verbs=get;list;watch
+
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
 //+kubebuilder:webhook:path=/validate-serviceaccount-kubetrail-io-v1beta1-token,mutating=false,failurePolicy=fail,sideEffects=None,groups=serviceaccount.kubetrail.io,resources=tokens,verbs=create;update,versions=v1beta1,name=vtoken.kb.io,admissionReviewVersions=v1
 
@@ -59,25 +175,70 @@ var _ webhook.Validator = &Token{}
 func (r *Token) ValidateCreate() error {
 	tokenlog.Info("validate create", "name", r.Name)
 
-	if r.Spec.RotationPeriodSeconds != nil && *r.Spec.RotationPeriodSeconds < 600 {
-		err := fmt.Errorf("rotation period seconds needs to be at least 600 seconds")
-		tokenlog.Error(err, "invalid rotation period")
+	if err := r.validateAnnotations(); err != nil {
 		return err
 	}
 
-	if r.Spec.DeletionGracePeriodSeconds != nil && *r.Spec.DeletionGracePeriodSeconds < 600 {
-		err := fmt.Errorf("token deletion grace period needs to be at least 600 seconds")
-		tokenlog.Error(err, "invalid token deletion grace period")
+	if err := r.validateSpec(); err != nil {
 		return err
 	}
 
-	return nil
+	return r.validatePolicies(true)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Token) ValidateUpdate(old runtime.Object) error {
 	tokenlog.Info("validate update", "name", r.Name)
 
+	// the operator has to be able to patch metadata such as finalizers of
+	// tokens being deleted, whatever policies were added since their creation
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+
+	if err := r.validateAnnotations(); err != nil {
+		return err
+	}
+
+	// the spec is only checked again when it changes, so that tokens admitted
+	// before a policy was added can still have their metadata updated
+	if oldToken, ok := old.(*Token); ok && equality.Semantic.DeepEqual(oldToken.Spec, r.Spec) {
+		return nil
+	}
+
+	if err := r.validateSpec(); err != nil {
+		return err
+	}
+
+	return r.validatePolicies(false)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Token) ValidateDelete() error {
+	tokenlog.Info("validate delete", "name", r.Name)
+
+	// TODO(user): fill in your validation logic upon object deletion.
+	return nil
+}
+
+// validateAnnotations validates the annotations requesting rotations and
+// revocations
+func (r *Token) validateAnnotations() error {
+	for _, annotation := range []string{AnnotationRotateAt, AnnotationRevokeAt} {
+		if value, ok := r.Annotations[annotation]; ok {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				err := fmt.Errorf("annotation %s needs to be an RFC 3339 timestamp: %w", annotation, err)
+				tokenlog.Error(err, "invalid annotation")
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSpec validates fields common to create and update
+func (r *Token) validateSpec() error {
 	if r.Spec.RotationPeriodSeconds != nil && *r.Spec.RotationPeriodSeconds < 600 {
 		err := fmt.Errorf("rotation period seconds needs to be at least 600 seconds")
 		tokenlog.Error(err, "invalid rotation period")
@@ -90,13 +251,413 @@ func (r *Token) ValidateUpdate(old runtime.Object) error {
 		return err
 	}
 
+	if r.Spec.Mode == TokenModeTokenRequest && r.Spec.RotationPeriodSeconds == nil && !r.hasRotationSchedule() {
+		err := fmt.Errorf("rotation period seconds or a rotation schedule is required in %s mode", TokenModeTokenRequest)
+		tokenlog.Error(err, "invalid rotation period")
+		return err
+	}
+
+	if rotation := r.Spec.Rotation; rotation != nil {
+		if err := r.validateRotation(rotation); err != nil {
+			tokenlog.Error(err, "invalid rotation")
+			return err
+		}
+	}
+
+	if r.Spec.Mode != TokenModeTokenRequest &&
+		(len(r.Spec.Audiences) > 0 || r.Spec.BoundObjectRef != nil) {
+		err := fmt.Errorf("audiences and bound object reference are only supported in %s mode", TokenModeTokenRequest)
+		tokenlog.Error(err, "invalid mode")
+		return err
+	}
+
+	for _, audience := range r.Spec.Audiences {
+		if len(audience) == 0 {
+			err := fmt.Errorf("audiences cannot contain empty values")
+			tokenlog.Error(err, "invalid audience")
+			return err
+		}
+	}
+
+	if r.Spec.ServiceAccountTemplate != nil && !r.Spec.CreateServiceAccount {
+		err := fmt.Errorf("service account template is only supported with createServiceAccount")
+		tokenlog.Error(err, "invalid service account template")
+		return err
+	}
+
+	if template := r.Spec.ServiceAccountTemplate; template != nil {
+		for _, imagePullSecret := range template.ImagePullSecrets {
+			if len(imagePullSecret.Name) == 0 {
+				err := fmt.Errorf("image pull secrets cannot contain empty names")
+				tokenlog.Error(err, "invalid service account template")
+				return err
+			}
+		}
+	}
+
+	if r.Spec.Output != nil && r.Spec.Output.Kubeconfig != nil {
+		kubeconfig := r.Spec.Output.Kubeconfig
+		if len(kubeconfig.Server) > 0 {
+			if server, err := url.Parse(kubeconfig.Server); err != nil || len(server.Scheme) == 0 || len(server.Host) == 0 {
+				err := fmt.Errorf("kubeconfig server %q needs to be an absolute URL", kubeconfig.Server)
+				tokenlog.Error(err, "invalid kubeconfig output")
+				return err
+			}
+		}
+
+		if len(kubeconfig.SecretName) > 0 {
+			if errs := validation.IsDNS1123Subdomain(kubeconfig.SecretName); len(errs) > 0 {
+				err := fmt.Errorf("kubeconfig secret name %q is invalid: %s", kubeconfig.SecretName, strings.Join(errs, ", "))
+				tokenlog.Error(err, "invalid kubeconfig output")
+				return err
+			}
+		}
+	}
+
+	if r.Spec.Output != nil {
+		for key, text := range r.Spec.Output.Templates {
+			if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+				err := fmt.Errorf("template key %q is invalid: %s", key, strings.Join(errs, ", "))
+				tokenlog.Error(err, "invalid template")
+				return err
+			}
+
+			if _, ok := reservedTemplateKeys[key]; ok {
+				err := fmt.Errorf("template key %q is reserved for the token data", key)
+				tokenlog.Error(err, "invalid template")
+				return err
+			}
+
+			tmpl, err := ParseTemplate(key, text)
+			if err != nil {
+				err := fmt.Errorf("template %q failed to parse: %w", key, err)
+				tokenlog.Error(err, "invalid template")
+				return err
+			}
+
+			if _, err := ExecuteTemplate(tmpl, sampleTemplateData(r)); err != nil {
+				err := fmt.Errorf("template %q failed to render: %w", key, err)
+				tokenlog.Error(err, "invalid template")
+				return err
+			}
+		}
+	}
+
+	if r.Spec.Output != nil && len(r.Spec.Output.Type) > 0 {
+		if err := r.validateOutputType(); err != nil {
+			tokenlog.Error(err, "invalid output type")
+			return err
+		}
+	}
+
+	if r.Spec.Target != nil {
+		if errs := validation.IsDNS1123Subdomain(r.Spec.Target.SecretName); len(errs) > 0 {
+			err := fmt.Errorf("target secret name %q is invalid: %s", r.Spec.Target.SecretName, strings.Join(errs, ", "))
+			tokenlog.Error(err, "invalid target")
+			return err
+		}
+	}
+
+	if replicateTo := r.Spec.ReplicateTo; replicateTo != nil {
+		if len(replicateTo.Namespaces) == 0 && replicateTo.NamespaceSelector == nil {
+			err := fmt.Errorf("replicate to needs namespaces or a namespace selector")
+			tokenlog.Error(err, "invalid replication")
+			return err
+		}
+
+		for _, namespace := range replicateTo.Namespaces {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				err := fmt.Errorf("replication namespace %q is invalid: %s", namespace, strings.Join(errs, ", "))
+				tokenlog.Error(err, "invalid replication")
+				return err
+			}
+		}
+
+		if replicateTo.NamespaceSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(replicateTo.NamespaceSelector); err != nil {
+				err := fmt.Errorf("replication namespace selector is invalid: %w", err)
+				tokenlog.Error(err, "invalid replication")
+				return err
+			}
+		}
+
+		if errs := validation.IsDNS1123Subdomain(replicateTo.SecretName); len(errs) > 0 {
+			err := fmt.Errorf("replication secret name %q is invalid: %s", replicateTo.SecretName, strings.Join(errs, ", "))
+			tokenlog.Error(err, "invalid replication")
+			return err
+		}
+	}
+
+	if ref := r.Spec.BoundObjectRef; ref != nil {
+		if _, ok := boundObjectKinds[ref.Kind]; !ok {
+			err := fmt.Errorf("bound object kind %q is not supported, needs to be one of Pod or Secret", ref.Kind)
+			tokenlog.Error(err, "invalid bound object reference")
+			return err
+		}
+
+		if ref.APIVersion != "v1" {
+			err := fmt.Errorf("bound object api version %q is not supported, needs to be v1", ref.APIVersion)
+			tokenlog.Error(err, "invalid bound object reference")
+			return err
+		}
+
+		if len(ref.Name) == 0 {
+			err := fmt.Errorf("bound object name is required")
+			tokenlog.Error(err, "invalid bound object reference")
+			return err
+		}
+	}
+
 	return nil
 }
 
-// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
-func (r *Token) ValidateDelete() error {
-	tokenlog.Info("validate delete", "name", r.Name)
+// hasRotationSchedule checks if the token rotates on a cron schedule
+func (r *Token) hasRotationSchedule() bool {
+	return r.Spec.Rotation != nil && len(r.Spec.Rotation.Schedule) > 0
+}
+
+// validateOutputType checks that the type of the target secret is known and
+// that the templates render the keys the type requires
+func (r *Token) validateOutputType() error {
+	secretType := r.Spec.Output.Type
+	requiredKeys, ok := outputSecretTypes[secretType]
+	if !ok {
+		return fmt.Errorf("output type %q is not supported", secretType)
+	}
+
+	if secretType == corev1.SecretTypeOpaque {
+		return nil
+	}
+
+	if r.Spec.Target == nil {
+		return fmt.Errorf("output type %s requires a target secret", secretType)
+	}
+
+	for _, key := range requiredKeys {
+		if _, ok := r.Spec.Output.Templates[key]; !ok {
+			return fmt.Errorf("output type %s requires a template for key %s", secretType, key)
+		}
+	}
+
+	if secretType == corev1.SecretTypeBasicAuth {
+		_, username := r.Spec.Output.Templates[corev1.BasicAuthUsernameKey]
+		_, password := r.Spec.Output.Templates[corev1.BasicAuthPasswordKey]
+		if !username && !password {
+			return fmt.Errorf(
+				"output type %s requires a template for key %s or %s",
+				secretType,
+				corev1.BasicAuthUsernameKey,
+				corev1.BasicAuthPasswordKey,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateRotation validates the rotation schedule and maintenance windows
+func (r *Token) validateRotation(rotation *RotationSpec) error {
+	if len(rotation.Schedule) > 0 {
+		if r.Spec.RotationPeriodSeconds != nil {
+			return fmt.Errorf("rotation schedule and rotation period seconds are mutually exclusive")
+		}
+
+		if err := validateSchedule(rotation.Schedule); err != nil {
+			return fmt.Errorf("rotation schedule %q is invalid: %w", rotation.Schedule, err)
+		}
+
+		// a token is issued on every activation, which is held to the same
+		// minimum as the rotation period
+		if interval := scheduleInterval(rotation.Schedule); interval < 600*time.Second {
+			return fmt.Errorf(
+				"rotation schedule %q activates every %s, which needs to be at least 600 seconds",
+				rotation.Schedule,
+				interval,
+			)
+		}
+	}
+
+	if len(rotation.TimeZone) > 0 {
+		if _, err := time.LoadLocation(rotation.TimeZone); err != nil {
+			return fmt.Errorf("rotation time zone %q is invalid: %w", rotation.TimeZone, err)
+		}
+	}
+
+	for _, window := range rotation.MaintenanceWindows {
+		if err := validateSchedule(window.Schedule); err != nil {
+			return fmt.Errorf("maintenance window schedule %q is invalid: %w", window.Schedule, err)
+		}
+
+		if window.DurationSeconds < 60 {
+			return fmt.Errorf("maintenance window duration seconds needs to be at least 60 seconds")
+		}
+	}
+
+	if rotation.MaxTokenAgeSeconds != nil && *rotation.MaxTokenAgeSeconds < 600 {
+		return fmt.Errorf("max token age seconds needs to be at least 600 seconds")
+	}
+
+	if rotation.JitterPercent < 0 || rotation.JitterPercent > 50 {
+		return fmt.Errorf("jitter percent needs to be between 0 and 50")
+	}
 
-	// TODO(user): fill in your validation logic upon object deletion.
 	return nil
 }
+
+// validateSchedule checks that the cron expression parses and activates,
+// since expressions such as 0 0 31 2 * parse but never activate
+func validateSchedule(spec string) error {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule never activates")
+	}
+
+	return nil
+}
+
+// scheduleInterval returns the shortest time between two activations of a
+// valid cron expression. Expressions activating too rarely to measure are
+// treated as activating once in eight years.
+func scheduleInterval(spec string) time.Duration {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return 0
+	}
+
+	if interval := schedule.MinInterval(); interval > 0 {
+		return interval
+	}
+	return 8 * 365 * 24 * time.Hour
+}
+
+// minRotationSeconds returns the shortest time between two rotations, which
+// is the rotation period or else the shortest interval of the schedule
+func (r *Token) minRotationSeconds() *int64 {
+	if r.Spec.RotationPeriodSeconds != nil {
+		return r.Spec.RotationPeriodSeconds
+	}
+	if r.hasRotationSchedule() {
+		seconds := int64(scheduleInterval(r.Spec.Rotation.Schedule) / time.Second)
+		return &seconds
+	}
+	return nil
+}
+
+// maxRotationSeconds returns the longest time a token may go without being
+// rotated, which is the rotation period or else the max token age
+func (r *Token) maxRotationSeconds() *int64 {
+	if r.Spec.RotationPeriodSeconds != nil {
+		return r.Spec.RotationPeriodSeconds
+	}
+	if r.Spec.Rotation != nil {
+		return r.Spec.Rotation.MaxTokenAgeSeconds
+	}
+	return nil
+}
+
+// validatePolicies validates the token against all token policies in its
+// namespace. The number of tokens is only checked on creation.
+func (r *Token) validatePolicies(create bool) error {
+	if policyReader == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	policies := &TokenPolicyList{}
+	if err := policyReader.List(ctx, policies, client.InNamespace(r.Namespace)); err != nil {
+		tokenlog.Error(err, "failed to list token policies")
+		return err
+	}
+
+	for _, policy := range policies.Items {
+		if err := r.validatePolicy(&policy); err != nil {
+			tokenlog.Error(err, "token policy violation", "policy", policy.Name)
+			return err
+		}
+
+		if create && policy.Spec.MaxTokens != nil {
+			tokens := &TokenList{}
+			if err := policyReader.List(ctx, tokens, client.InNamespace(r.Namespace)); err != nil {
+				tokenlog.Error(err, "failed to list tokens")
+				return err
+			}
+			if len(tokens.Items) >= int(*policy.Spec.MaxTokens) {
+				err := fmt.Errorf("token policy %s allows at most %d tokens in namespace %s",
+					policy.Name, *policy.Spec.MaxTokens, r.Namespace)
+				tokenlog.Error(err, "token policy violation", "policy", policy.Name)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePolicy validates the spec of the token against a token policy
+func (r *Token) validatePolicy(policy *TokenPolicy) error {
+	spec := policy.Spec
+
+	if minRotationSeconds := r.minRotationSeconds(); spec.MinRotationPeriodSeconds != nil &&
+		minRotationSeconds != nil && *minRotationSeconds < *spec.MinRotationPeriodSeconds {
+		return fmt.Errorf("token policy %s requires a rotation period of at least %d seconds",
+			policy.Name, *spec.MinRotationPeriodSeconds)
+	}
+
+	if maxRotationSeconds := r.maxRotationSeconds(); spec.MaxRotationPeriodSeconds != nil &&
+		(maxRotationSeconds == nil || *maxRotationSeconds > *spec.MaxRotationPeriodSeconds) {
+		return fmt.Errorf("token policy %s requires a rotation period of at most %d seconds",
+			policy.Name, *spec.MaxRotationPeriodSeconds)
+	}
+
+	if spec.MinDeletionGracePeriodSeconds != nil &&
+		(r.Spec.DeletionGracePeriodSeconds == nil || *r.Spec.DeletionGracePeriodSeconds < *spec.MinDeletionGracePeriodSeconds) {
+		return fmt.Errorf("token policy %s requires a deletion grace period of at least %d seconds",
+			policy.Name, *spec.MinDeletionGracePeriodSeconds)
+	}
+
+	if spec.MaxDeletionGracePeriodSeconds != nil && r.Spec.DeletionGracePeriodSeconds != nil &&
+		*r.Spec.DeletionGracePeriodSeconds > *spec.MaxDeletionGracePeriodSeconds {
+		return fmt.Errorf("token policy %s requires a deletion grace period of at most %d seconds",
+			policy.Name, *spec.MaxDeletionGracePeriodSeconds)
+	}
+
+	if len(spec.AllowedServiceAccountNames) > 0 && !contains(spec.AllowedServiceAccountNames, r.Spec.ServiceAccountName) {
+		return fmt.Errorf("token policy %s does not allow service account %s, allowed service accounts are %s",
+			policy.Name, r.Spec.ServiceAccountName, strings.Join(spec.AllowedServiceAccountNames, ", "))
+	}
+
+	if contains(spec.DeniedServiceAccountNames, r.Spec.ServiceAccountName) {
+		return fmt.Errorf("token policy %s denies service account %s",
+			policy.Name, r.Spec.ServiceAccountName)
+	}
+
+	if len(spec.AllowedAudiences) > 0 {
+		if len(r.Spec.Audiences) == 0 {
+			return fmt.Errorf("token policy %s requires audiences to be one of %s",
+				policy.Name, strings.Join(spec.AllowedAudiences, ", "))
+		}
+		for _, audience := range r.Spec.Audiences {
+			if !contains(spec.AllowedAudiences, audience) {
+				return fmt.Errorf("token policy %s does not allow audience %s, allowed audiences are %s",
+					policy.Name, audience, strings.Join(spec.AllowedAudiences, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// contains checks if the value is in the list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
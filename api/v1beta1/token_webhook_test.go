@@ -0,0 +1,82 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePolicyMinRotationPeriod(t *testing.T) {
+	seconds := func(value int64) *int64 {
+		return &value
+	}
+
+	policy := &TokenPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "restricted"},
+		Spec: TokenPolicySpec{
+			MinRotationPeriodSeconds: seconds(3600),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		spec    TokenSpec
+		wantErr bool
+	}{
+		{
+			name: "rotation period above the minimum",
+			spec: TokenSpec{RotationPeriodSeconds: seconds(7200)},
+		},
+		{
+			name:    "rotation period below the minimum",
+			spec:    TokenSpec{RotationPeriodSeconds: seconds(1800)},
+			wantErr: true,
+		},
+		{
+			name: "schedule activating less often than the minimum",
+			spec: TokenSpec{Rotation: &RotationSpec{Schedule: "0 */2 * * *"}},
+		},
+		{
+			name:    "schedule activating more often than the minimum",
+			spec:    TokenSpec{Rotation: &RotationSpec{Schedule: "*/30 * * * *"}},
+			wantErr: true,
+		},
+		{
+			name:    "schedule activating twice in a short span once a day",
+			spec:    TokenSpec{Rotation: &RotationSpec{Schedule: "0,20 3 * * *"}},
+			wantErr: true,
+		},
+		{
+			name: "neither rotation period nor schedule",
+			spec: TokenSpec{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := &Token{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "default"},
+				Spec:       test.spec,
+			}
+			if err := token.validatePolicy(policy); (err != nil) != test.wantErr {
+				t.Errorf("validatePolicy() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TokenPolicySpec defines the constraints on the Tokens of a namespace
+type TokenPolicySpec struct {
+	// MinRotationPeriodSeconds is the shortest rotation period tokens may use.
+	// Tokens with a rotation schedule are held to the shortest interval
+	// between its activations.
+	MinRotationPeriodSeconds *int64 `json:"minRotationPeriodSeconds,omitempty"`
+	// MaxRotationPeriodSeconds is the longest rotation period tokens may use.
+	// Tokens with a rotation schedule are held to their max token age instead.
+	// Tokens without either are rejected when set.
+	MaxRotationPeriodSeconds *int64 `json:"maxRotationPeriodSeconds,omitempty"`
+	// MinDeletionGracePeriodSeconds is the shortest deletion grace period
+	// tokens may use. Tokens without a grace period are rejected when set.
+	MinDeletionGracePeriodSeconds *int64 `json:"minDeletionGracePeriodSeconds,omitempty"`
+	// MaxDeletionGracePeriodSeconds is the longest deletion grace period
+	// tokens may use
+	MaxDeletionGracePeriodSeconds *int64 `json:"maxDeletionGracePeriodSeconds,omitempty"`
+	// AllowedServiceAccountNames lists the service accounts tokens may be
+	// issued for. All service accounts are allowed when empty.
+	AllowedServiceAccountNames []string `json:"allowedServiceAccountNames,omitempty"`
+	// DeniedServiceAccountNames lists the service accounts tokens may not be
+	// issued for
+	DeniedServiceAccountNames []string `json:"deniedServiceAccountNames,omitempty"`
+	// AllowedAudiences lists the audiences tokens may request. Tokens need to
+	// list their audiences explicitly when set.
+	AllowedAudiences []string `json:"allowedAudiences,omitempty"`
+	// MaxTokens is the maximum number of tokens in the namespace
+	MaxTokens *int32 `json:"maxTokens,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TokenPolicy is the Schema for the tokenpolicies API. All policies in a
+// namespace apply to the Tokens created or updated in it.
+type TokenPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TokenPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TokenPolicyList contains a list of TokenPolicy
+type TokenPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TokenPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TokenPolicy{}, &TokenPolicyList{})
+}
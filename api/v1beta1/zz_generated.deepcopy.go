@@ -22,10 +22,263 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BoundObjectReference) DeepCopyInto(out *BoundObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BoundObjectReference.
+func (in *BoundObjectReference) DeepCopy() *BoundObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(BoundObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterToken) DeepCopyInto(out *ClusterToken) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterToken.
+func (in *ClusterToken) DeepCopy() *ClusterToken {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterToken)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterToken) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTokenList) DeepCopyInto(out *ClusterTokenList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterToken, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTokenList.
+func (in *ClusterTokenList) DeepCopy() *ClusterTokenList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTokenList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTokenList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTokenSpec) DeepCopyInto(out *ClusterTokenSpec) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTokenSpec.
+func (in *ClusterTokenSpec) DeepCopy() *ClusterTokenSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTokenSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTokenStatus) DeepCopyInto(out *ClusterTokenStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NotReadyNamespaces != nil {
+		in, out := &in.NotReadyNamespaces, &out.NotReadyNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailedNamespaces != nil {
+		in, out := &in.FailedNamespaces, &out.FailedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTokenStatus.
+func (in *ClusterTokenStatus) DeepCopy() *ClusterTokenStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTokenStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeconfigOutput) DeepCopyInto(out *KubeconfigOutput) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeconfigOutput.
+func (in *KubeconfigOutput) DeepCopy() *KubeconfigOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeconfigOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaStatus) DeepCopyInto(out *ReplicaStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaStatus.
+func (in *ReplicaStatus) DeepCopy() *ReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicationSpec) DeepCopyInto(out *ReplicationSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicationSpec.
+func (in *ReplicationSpec) DeepCopy() *ReplicationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotationSpec) DeepCopyInto(out *RotationSpec) {
+	*out = *in
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxTokenAgeSeconds != nil {
+		in, out := &in.MaxTokenAgeSeconds, &out.MaxTokenAgeSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotationSpec.
+func (in *RotationSpec) DeepCopy() *RotationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RotationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountTemplate) DeepCopyInto(out *ServiceAccountTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountTemplate.
+func (in *ServiceAccountTemplate) DeepCopy() *ServiceAccountTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Token) DeepCopyInto(out *Token) {
 	*out = *in
@@ -85,6 +338,170 @@ func (in *TokenList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenOutput) DeepCopyInto(out *TokenOutput) {
+	*out = *in
+	if in.Kubeconfig != nil {
+		in, out := &in.Kubeconfig, &out.Kubeconfig
+		*out = new(KubeconfigOutput)
+		**out = **in
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenOutput.
+func (in *TokenOutput) DeepCopy() *TokenOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenPolicy) DeepCopyInto(out *TokenPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenPolicy.
+func (in *TokenPolicy) DeepCopy() *TokenPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TokenPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenPolicyList) DeepCopyInto(out *TokenPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TokenPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenPolicyList.
+func (in *TokenPolicyList) DeepCopy() *TokenPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TokenPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenPolicySpec) DeepCopyInto(out *TokenPolicySpec) {
+	*out = *in
+	if in.MinRotationPeriodSeconds != nil {
+		in, out := &in.MinRotationPeriodSeconds, &out.MinRotationPeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxRotationPeriodSeconds != nil {
+		in, out := &in.MaxRotationPeriodSeconds, &out.MaxRotationPeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MinDeletionGracePeriodSeconds != nil {
+		in, out := &in.MinDeletionGracePeriodSeconds, &out.MinDeletionGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxDeletionGracePeriodSeconds != nil {
+		in, out := &in.MaxDeletionGracePeriodSeconds, &out.MaxDeletionGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.AllowedServiceAccountNames != nil {
+		in, out := &in.AllowedServiceAccountNames, &out.AllowedServiceAccountNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedServiceAccountNames != nil {
+		in, out := &in.DeniedServiceAccountNames, &out.DeniedServiceAccountNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedAudiences != nil {
+		in, out := &in.AllowedAudiences, &out.AllowedAudiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxTokens != nil {
+		in, out := &in.MaxTokens, &out.MaxTokens
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenPolicySpec.
+func (in *TokenPolicySpec) DeepCopy() *TokenPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenSecretStatus) DeepCopyInto(out *TokenSecretStatus) {
+	*out = *in
+	in.IssuedAt.DeepCopyInto(&out.IssuedAt)
+	if in.RotatesAt != nil {
+		in, out := &in.RotatesAt, &out.RotatesAt
+		*out = (*in).DeepCopy()
+	}
+	if in.DeleteAt != nil {
+		in, out := &in.DeleteAt, &out.DeleteAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSecretStatus.
+func (in *TokenSecretStatus) DeepCopy() *TokenSecretStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenSecretStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TokenSpec) DeepCopyInto(out *TokenSpec) {
 	*out = *in
@@ -98,6 +515,41 @@ func (in *TokenSpec) DeepCopyInto(out *TokenSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BoundObjectRef != nil {
+		in, out := &in.BoundObjectRef, &out.BoundObjectRef
+		*out = new(BoundObjectReference)
+		**out = **in
+	}
+	if in.ServiceAccountTemplate != nil {
+		in, out := &in.ServiceAccountTemplate, &out.ServiceAccountTemplate
+		*out = new(ServiceAccountTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Output != nil {
+		in, out := &in.Output, &out.Output
+		*out = new(TokenOutput)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(TokenTarget)
+		**out = **in
+	}
+	if in.ReplicateTo != nil {
+		in, out := &in.ReplicateTo, &out.ReplicateTo
+		*out = new(ReplicationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rotation != nil {
+		in, out := &in.Rotation, &out.Rotation
+		*out = new(RotationSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSpec.
@@ -120,6 +572,42 @@ func (in *TokenStatus) DeepCopyInto(out *TokenStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.PendingVerificationFailedAt != nil {
+		in, out := &in.PendingVerificationFailedAt, &out.PendingVerificationFailedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Secrets != nil {
+		in, out := &in.Secrets, &out.Secrets
+		*out = make([]TokenSecretStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRotationTime != nil {
+		in, out := &in.NextRotationTime, &out.NextRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]ReplicaStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.ObservedRotateAt != nil {
+		in, out := &in.ObservedRotateAt, &out.ObservedRotateAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ObservedRevokeAt != nil {
+		in, out := &in.ObservedRevokeAt, &out.ObservedRevokeAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRevocationTime != nil {
+		in, out := &in.LastRevocationTime, &out.LastRevocationTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenStatus.
@@ -131,3 +619,64 @@ func (in *TokenStatus) DeepCopy() *TokenStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenTarget) DeepCopyInto(out *TokenTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenTarget.
+func (in *TokenTarget) DeepCopy() *TokenTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenTemplateMetadata) DeepCopyInto(out *TokenTemplateMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenTemplateMetadata.
+func (in *TokenTemplateMetadata) DeepCopy() *TokenTemplateMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenTemplateMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenTemplateSpec) DeepCopyInto(out *TokenTemplateSpec) {
+	*out = *in
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenTemplateSpec.
+func (in *TokenTemplateSpec) DeepCopy() *TokenTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ClusterTokenReconciler reconciles a ClusterToken object
+type ClusterTokenReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Recorder emits events for the reconciled objects
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=clustertokens,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=clustertokens/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=clustertokens/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Reconcile creates a Token in every namespace selected by the ClusterToken,
+// deletes the Tokens of namespaces that are no longer selected and reports
+// the readiness of the Tokens in the status of the ClusterToken.
+func (r *ClusterTokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+
+	object := &apiv1beta1.ClusterToken{}
+	if err := r.Get(ctx, req.NamespacedName, object); err != nil {
+		if apimachineryerrors.IsNotFound(err) {
+			// Tokens are garbage collected through their owner references
+			reqLogger.Info("object not found")
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Error(err, "failed to get object")
+		return ctrl.Result{}, err
+	}
+
+	if object.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	selector, err := v12.LabelSelectorAsSelector(&object.Spec.NamespaceSelector)
+	if err != nil {
+		reqLogger.Error(err, "failed to parse namespace selector")
+		return ctrl.Result{}, err
+	}
+
+	namespaces := &v1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		reqLogger.Error(err, "failed to list namespaces")
+		return ctrl.Result{}, err
+	}
+
+	// a failure in one namespace does not hold up the others
+	selected := make(map[string]struct{})
+	var failedNamespaces []string
+	for _, namespace := range namespaces.Items {
+		if namespace.DeletionTimestamp != nil {
+			continue
+		}
+		selected[namespace.Name] = struct{}{}
+		if err := r.reconcileChild(ctx, object, namespace.Name); err != nil {
+			failedNamespaces = append(failedNamespaces, namespace.Name)
+		}
+	}
+	sort.Strings(failedNamespaces)
+
+	children := &apiv1beta1.TokenList{}
+	if err := r.List(ctx, children, client.MatchingLabels{labelClusterToken: object.Name}); err != nil {
+		reqLogger.Error(err, "failed to list tokens")
+		return ctrl.Result{}, err
+	}
+
+	// delete the tokens of namespaces that are no longer selected
+	status := object.Status.DeepCopy()
+	status.ObservedGeneration = object.Generation
+	status.Tokens = 0
+	status.ReadyTokens = 0
+	status.NotReadyNamespaces = nil
+	status.FailedNamespaces = failedNamespaces
+	for _, child := range children.Items {
+		child := child
+		if !v12.IsControlledBy(&child, object) || child.DeletionTimestamp != nil {
+			continue
+		}
+
+		if _, ok := selected[child.Namespace]; !ok {
+			if err := r.Delete(ctx, &child); err != nil && !apimachineryerrors.IsNotFound(err) {
+				reqLogger.Error(err, "failed to delete token", "namespace", child.Namespace, "name", child.Name)
+				return ctrl.Result{}, err
+			}
+			reqLogger.Info("deleted token", "namespace", child.Namespace, "name", child.Name)
+			continue
+		}
+
+		status.Tokens++
+		if meta.IsStatusConditionTrue(child.Status.Conditions, conditionTypeReady) {
+			status.ReadyTokens++
+		} else {
+			status.NotReadyNamespaces = append(status.NotReadyNamespaces, child.Namespace)
+		}
+	}
+	sort.Strings(status.NotReadyNamespaces)
+
+	if len(status.NotReadyNamespaces) == 0 {
+		meta.SetStatusCondition(&status.Conditions, v12.Condition{
+			Type:               conditionTypeReady,
+			Status:             v12.ConditionTrue,
+			ObservedGeneration: object.Generation,
+			Reason:             reasonTokenPopulated,
+			Message:            fmt.Sprintf("%d of %d tokens are ready", status.ReadyTokens, status.Tokens),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, v12.Condition{
+			Type:               conditionTypeReady,
+			Status:             v12.ConditionFalse,
+			ObservedGeneration: object.Generation,
+			Reason:             reasonProvisioningToken,
+			Message: fmt.Sprintf(
+				"%d of %d tokens are ready, waiting for namespaces %s",
+				status.ReadyTokens,
+				status.Tokens,
+				strings.Join(status.NotReadyNamespaces, ", "),
+			),
+		})
+	}
+
+	if len(status.FailedNamespaces) > 0 {
+		meta.SetStatusCondition(&status.Conditions, v12.Condition{
+			Type:               conditionTypeDegraded,
+			Status:             v12.ConditionTrue,
+			ObservedGeneration: object.Generation,
+			Reason:             reasonTokenReconcileFailed,
+			Message: fmt.Sprintf(
+				"failed to create or update tokens in namespaces %s",
+				strings.Join(status.FailedNamespaces, ", "),
+			),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, v12.Condition{
+			Type:               conditionTypeDegraded,
+			Status:             v12.ConditionFalse,
+			ObservedGeneration: object.Generation,
+			Reason:             reasonTokensReconciled,
+			Message:            "tokens are created and updated in all selected namespaces",
+		})
+	}
+
+	if !equality.Semantic.DeepEqual(&object.Status, status) {
+		patch := client.MergeFrom(object.DeepCopy())
+		status.DeepCopyInto(&object.Status)
+		if err := r.Status().Patch(ctx, object, patch, client.FieldOwner(fieldOwner)); err != nil {
+			reqLogger.Error(err, "failed to update object status")
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("updated object status")
+	}
+
+	// failed namespaces are retried with backoff
+	if len(failedNamespaces) > 0 {
+		return ctrl.Result{}, fmt.Errorf(
+			"failed to reconcile tokens in namespaces %s",
+			strings.Join(failedNamespaces, ", "),
+		)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileChild creates or updates the token of the object in the namespace.
+// Tokens with the same name that are not controlled by the object are left alone.
+func (r *ClusterTokenReconciler) reconcileChild(ctx context.Context, object *apiv1beta1.ClusterToken, namespace string) error {
+	reqLogger := log.FromContext(ctx)
+
+	template := object.Spec.Template
+	// copies to other namespaces are refused by the webhook, and dropped for
+	// cluster tokens admitted before it
+	spec := template.Spec.DeepCopy()
+	spec.ReplicateTo = nil
+
+	labels := map[string]string{labelClusterToken: object.Name}
+	for key, value := range template.Metadata.Labels {
+		labels[key] = value
+	}
+
+	child := &apiv1beta1.Token{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: object.Name}, child); err != nil {
+		if !apimachineryerrors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to get token", "namespace", namespace)
+			return err
+		}
+
+		child = &apiv1beta1.Token{
+			ObjectMeta: v12.ObjectMeta{
+				Name:        object.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: template.Metadata.Annotations,
+			},
+			Spec: *spec,
+		}
+		if err := controllerutil.SetControllerReference(object, child, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, child); err != nil {
+			if apimachineryerrors.IsAlreadyExists(err) {
+				// picked up on the next reconcile once the cache has caught up
+				return nil
+			}
+			reqLogger.Error(err, "failed to create token", "namespace", namespace)
+			return err
+		}
+		reqLogger.Info("created token", "namespace", namespace, "name", child.Name)
+		return nil
+	}
+
+	if !v12.IsControlledBy(child, object) {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonTokenNameConflict,
+			"token %s/%s already exists and is not controlled by the cluster token",
+			namespace,
+			child.Name,
+		)
+		return nil
+	}
+
+	updated := child.DeepCopy()
+	for key, value := range labels {
+		if updated.Labels == nil {
+			updated.Labels = make(map[string]string)
+		}
+		updated.Labels[key] = value
+	}
+	for key, value := range template.Metadata.Annotations {
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		updated.Annotations[key] = value
+	}
+	// the template is compared with the defaults of the webhook applied, so
+	// that fields removed from the template are removed from the token. The
+	// webhook defaults an empty mode of an existing token to legacy secrets,
+	// so the mode the token was created with is kept.
+	desired := &apiv1beta1.Token{
+		ObjectMeta: v12.ObjectMeta{Name: object.Name, Namespace: namespace},
+		Spec:       *spec,
+	}
+	if len(desired.Spec.Mode) == 0 {
+		desired.Spec.Mode = child.Spec.Mode
+	}
+	desired.SetDefaults()
+	if !equality.Semantic.DeepEqual(desired.Spec, updated.Spec) {
+		updated.Spec = desired.Spec
+	}
+	if equality.Semantic.DeepEqual(child, updated) {
+		return nil
+	}
+
+	if err := r.Update(ctx, updated); err != nil {
+		reqLogger.Error(err, "failed to update token", "namespace", namespace, "name", child.Name)
+		return err
+	}
+	reqLogger.Info("updated token", "namespace", namespace, "name", child.Name)
+
+	return nil
+}
+
+// clusterTokensForNamespace maps a namespace to reconcile requests for all
+// cluster tokens, so that tokens follow namespaces as they are created,
+// relabeled and deleted
+func (r *ClusterTokenReconciler) clusterTokensForNamespace(object client.Object) []reconcile.Request {
+	clusterTokens := &apiv1beta1.ClusterTokenList{}
+	if err := r.List(context.Background(), clusterTokens); err != nil {
+		ctrl.Log.WithName("cluster-tokens-for-namespace").Error(err, "failed to list cluster tokens", "namespace", object.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusterTokens.Items))
+	for _, clusterToken := range clusterTokens.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: clusterToken.Name},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterTokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&apiv1beta1.ClusterToken{}).
+		Owns(&apiv1beta1.Token{}).
+		Watches(
+			&source.Kind{Type: &v1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.clusterTokensForNamespace),
+		).
+		Complete(r)
+}
@@ -1,15 +1,72 @@
 package controllers
 
+import "time"
+
 const (
-	finalizer                     = "serviceaccount.kubetrail.io/finalizer"
-	reasonObjectInitialized       = "objectInitialized"
-	reasonObjectMarkedForDeletion = "objectMarkedForDeletion"
-	reasonFinalizerAdded          = "finalizerAdded"
-	reasonCreatedToken            = "createdToken"
-	reasonDeletedToken            = "deletedToken"
-	phasePending                  = "pending"
-	phaseReady                    = "ready"
-	phaseTerminating              = "terminating"
-	conditionTypeObject           = "object"
-	conditionTypeInfluxdb         = "influxdb"
+	finalizer                        = "serviceaccount.kubetrail.io/finalizer"
+	reasonObjectInitialized          = "objectInitialized"
+	reasonObjectMarkedForDeletion    = "objectMarkedForDeletion"
+	reasonCreatedToken               = "createdToken"
+	reasonDeletedToken               = "deletedToken"
+	reasonProvisioningToken          = "provisioningToken"
+	reasonTokenPopulated             = "tokenPopulated"
+	reasonTokenNotPopulated          = "tokenNotPopulated"
+	reasonTokenRotating              = "tokenRotating"
+	reasonTokenRotated               = "tokenRotated"
+	reasonTokenExpiringSoon          = "tokenExpiringSoon"
+	reasonTokenNotExpiring           = "tokenNotExpiring"
+	reasonServiceAccountFound        = "serviceAccountFound"
+	reasonServiceAccountNotFound     = "serviceAccountNotFound"
+	reasonServiceAccountCreated      = "serviceAccountCreated"
+	reasonServiceAccountRecreated    = "serviceAccountRecreated"
+	reasonSecretMissing              = "secretMissing"
+	reasonSecretModified             = "secretModified"
+	reasonSecretRepaired             = "secretRepaired"
+	reasonSecretNameConflict         = "secretNameConflict"
+	reasonWaitingForGracePeriod      = "waitingForGracePeriod"
+	reasonTokenNameConflict          = "tokenNameConflict"
+	reasonRotationRequested          = "rotationRequested"
+	reasonTokenRevoked               = "tokenRevoked"
+	reasonTokenSuspended             = "tokenSuspended"
+	reasonRotationFrozen             = "rotationFrozen"
+	reasonRotationDeferred           = "rotationDeferred"
+	reasonNotSuspended               = "notSuspended"
+	reasonWaitingForIssuanceBudget   = "waitingForIssuanceBudget"
+	reasonTokenVerificationFailed    = "tokenVerificationFailed"
+	reasonTokenDiscarded             = "tokenDiscarded"
+	reasonInvalidRotationSchedule    = "invalidRotationSchedule"
+	reasonOutputRenderFailed         = "outputRenderFailed"
+	reasonTokenReconcileFailed       = "tokenReconcileFailed"
+	reasonTokensReconciled           = "tokensReconciled"
+	phasePending                     = "pending"
+	phaseProvisioning                = "provisioning"
+	phaseReady                       = "ready"
+	phaseTerminating                 = "terminating"
+	conditionTypeReady               = "Ready"
+	conditionTypeRotating            = "Rotating"
+	conditionTypeDegraded            = "Degraded"
+	conditionTypeServiceAccountFound = "ServiceAccountFound"
+	conditionTypeExpiringSoon        = "ExpiringSoon"
+	conditionTypeSuspended           = "Suspended"
+	conditionTypeLegacyObject        = "object"
+	conditionTypeLegacyInfluxdb      = "influxdb"
+	annotationExpirationTimestamp    = "serviceaccount.kubetrail.io/expiration-timestamp"
+	annotationChecksum               = "serviceaccount.kubetrail.io/checksum"
+	annotationOutput                 = "serviceaccount.kubetrail.io/output"
+	annotationOutputKeys             = "serviceaccount.kubetrail.io/output-keys"
+	annotationReplicaOf              = "serviceaccount.kubetrail.io/replica-of"
+	keyKubeconfig                    = "kubeconfig"
+	labelManagedBy                   = "app.kubernetes.io/managed-by"
+	labelClusterToken                = "serviceaccount.kubetrail.io/cluster-token"
+	managedBy                        = "serviceaccount-operator"
+	fieldOwner                       = "serviceaccount-operator"
+	indexOwnerUID                    = ".metadata.ownerReferences.token.uid"
+	indexServiceAccountName          = ".spec.serviceAccountName"
+	indexReplicaOf                   = ".metadata.annotations.replica-of"
+	expiringSoonThreshold            = 5 * time.Minute
+	requeueSafetyMargin              = 2 * time.Second
+	verificationRetryPeriod          = time.Minute
+	maxExpiredSecretStatuses         = 10
+	legacySecretsPageSize            = 500
+	minTokenExpirationSeconds        = 600
 )
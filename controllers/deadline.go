@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// deadline tracks the earliest upcoming point in time at which an object
+// needs to be reconciled again
+type deadline struct {
+	next time.Time
+}
+
+// add records t if it is in the future and earlier than any recorded time
+func (d *deadline) add(t time.Time) {
+	if t.IsZero() || !t.After(time.Now()) {
+		return
+	}
+
+	if d.next.IsZero() || t.Before(d.next) {
+		d.next = t
+	}
+}
+
+// result returns a reconcile result that requeues shortly after the
+// earliest recorded time, or does not requeue if none was recorded
+func (d *deadline) result() ctrl.Result {
+	if d.next.IsZero() {
+		return ctrl.Result{}
+	}
+
+	return ctrl.Result{
+		RequeueAfter: time.Until(d.next) + requeueSafetyMargin,
+	}
+}
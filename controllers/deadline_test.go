@@ -0,0 +1,73 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  time.Duration
+	}{
+		{
+			name: "nothing recorded",
+		},
+		{
+			name:  "zero and past times are ignored",
+			times: []time.Time{{}, now.Add(-time.Minute)},
+		},
+		{
+			name:  "single time",
+			times: []time.Time{now.Add(time.Hour)},
+			want:  time.Hour,
+		},
+		{
+			name:  "earliest of several times",
+			times: []time.Time{now.Add(time.Hour), now.Add(10 * time.Minute), now.Add(-time.Minute), now.Add(30 * time.Minute)},
+			want:  10 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var next deadline
+			for _, at := range tt.times {
+				next.add(at)
+			}
+
+			result := next.result()
+			if tt.want == 0 {
+				if !result.IsZero() {
+					t.Errorf("result() = %+v, want no requeue", result)
+				}
+				return
+			}
+
+			// the time until the deadline shrinks while the test runs
+			if result.RequeueAfter > tt.want+requeueSafetyMargin ||
+				result.RequeueAfter < tt.want+requeueSafetyMargin-time.Second {
+				t.Errorf("result().RequeueAfter = %s, want %s", result.RequeueAfter, tt.want+requeueSafetyMargin)
+			}
+		})
+	}
+}
@@ -5,19 +5,48 @@ import (
 	"time"
 )
 
-var cache map[string]time.Time
-var mu sync.Mutex
+// issuanceBudget limits the number of tokens issued across all objects
+// within a sliding window, so that overdue rotations are spread out rather
+// than issued in a single burst
+type issuanceBudget struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	issued []time.Time
+	now    func() time.Time
+}
 
-func init() {
-	cache = make(map[string]time.Time)
+// newIssuanceBudget returns a budget of limit issuances per window. A limit
+// of zero or less does not limit issuances.
+func newIssuanceBudget(limit int, window time.Duration) *issuanceBudget {
+	return &issuanceBudget{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
 }
 
-func rateLimit(name string, every time.Duration, f func()) {
-	mu.Lock()
-	defer mu.Unlock()
+// take records an issuance if the budget allows it, or else returns the time
+// until it does. Urgent issuances are always recorded, so that they count
+// against the budget without waiting for it.
+func (b *issuanceBudget) take(urgent bool) (time.Duration, bool) {
+	if b == nil || b.limit <= 0 {
+		return 0, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	if last, ok := cache[name]; !ok || time.Since(last) >= every {
-		go f()
-		cache[name] = time.Now()
+	now := b.now()
+	cutoff := now.Add(-b.window)
+	for len(b.issued) > 0 && !b.issued[0].After(cutoff) {
+		b.issued = b.issued[1:]
 	}
+
+	if !urgent && len(b.issued) >= b.limit {
+		return b.issued[len(b.issued)-b.limit].Sub(cutoff), false
+	}
+
+	b.issued = append(b.issued, now)
+	return 0, true
 }
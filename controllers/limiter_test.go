@@ -0,0 +1,149 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIssuanceBudgetTake(t *testing.T) {
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type take struct {
+		after  time.Duration
+		urgent bool
+		wait   time.Duration
+		ok     bool
+	}
+
+	tests := []struct {
+		name   string
+		limit  int
+		window time.Duration
+		takes  []take
+	}{
+		{
+			name:   "unlimited",
+			limit:  0,
+			window: time.Minute,
+			takes: []take{
+				{ok: true},
+				{ok: true},
+				{ok: true},
+			},
+		},
+		{
+			name:   "exhausted within the window",
+			limit:  2,
+			window: time.Minute,
+			takes: []take{
+				{ok: true},
+				{after: 10 * time.Second, ok: true},
+				{after: 20 * time.Second, wait: 40 * time.Second},
+				{after: 30 * time.Second, wait: 30 * time.Second},
+			},
+		},
+		{
+			name:   "issuances expire with the window",
+			limit:  2,
+			window: time.Minute,
+			takes: []take{
+				{ok: true},
+				{after: 10 * time.Second, ok: true},
+				{after: time.Minute, ok: true},
+				{after: 65 * time.Second, wait: 5 * time.Second},
+				{after: 70 * time.Second, ok: true},
+			},
+		},
+		{
+			name:   "urgent issuances bypass an exhausted budget",
+			limit:  1,
+			window: time.Minute,
+			takes: []take{
+				{ok: true},
+				{after: 10 * time.Second, wait: 50 * time.Second},
+				{after: 10 * time.Second, urgent: true, ok: true},
+				{after: 20 * time.Second, urgent: true, ok: true},
+			},
+		},
+		{
+			name:   "urgent issuances count against the budget",
+			limit:  2,
+			window: time.Minute,
+			takes: []take{
+				{urgent: true, ok: true},
+				{after: 10 * time.Second, urgent: true, ok: true},
+				{after: 20 * time.Second, wait: 40 * time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := newIssuanceBudget(tt.limit, tt.window)
+			for i, take := range tt.takes {
+				now := start.Add(take.after)
+				budget.now = func() time.Time { return now }
+
+				wait, ok := budget.take(take.urgent)
+				if ok != take.ok || wait != take.wait {
+					t.Errorf("take %d = (%s, %t), want (%s, %t)", i, wait, ok, take.wait, take.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestIssuanceBudgetNil(t *testing.T) {
+	var budget *issuanceBudget
+	if wait, ok := budget.take(false); !ok || wait != 0 {
+		t.Errorf("take = (%s, %t), want (0s, true)", wait, ok)
+	}
+}
+
+func TestRotationJitter(t *testing.T) {
+	token := func(uid types.UID) *apiv1beta1.Token {
+		return &apiv1beta1.Token{ObjectMeta: v12.ObjectMeta{UID: uid}}
+	}
+
+	interval := 24 * time.Hour
+	first := token("5c7b7a4e-8f2a-4a1e-9d3c-1f0e2b3c4d5e")
+	second := token("0f9e8d7c-6b5a-4938-8271-605f4e3d2c1b")
+
+	if got := rotationJitter(first, interval, 0); got != 0 {
+		t.Errorf("jitter without percent = %s, want 0s", got)
+	}
+
+	jitter := rotationJitter(first, interval, 10)
+	if jitter < 0 || jitter > interval/10 {
+		t.Errorf("jitter = %s, want within [0s, %s]", jitter, interval/10)
+	}
+	if again := rotationJitter(first, interval, 10); again != jitter {
+		t.Errorf("jitter of the same object = %s, want %s", again, jitter)
+	}
+	if other := rotationJitter(second, interval, 10); other == jitter {
+		t.Errorf("jitter of another object = %s, want it to differ from %s", other, jitter)
+	}
+	if full := rotationJitter(first, interval, 100); full < 9*jitter || full > 11*jitter {
+		t.Errorf("jitter at 100 percent = %s, want ten times %s", full, jitter)
+	}
+}
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// deferredRotations counts the token issuances deferred while issuance was
+// suspended, once per deferred secret
+var deferredRotations = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "serviceaccount_operator_deferred_rotations_total",
+		Help: "Number of token issuances deferred while token issuance was suspended",
+	},
+)
+
+func init() {
+	metrics.Registry.MustRegister(deferredRotations)
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setCondition sets a condition on the status, recording the generation
+// of the object it was observed at
+func setCondition(
+	status *apiv1beta1.TokenStatus,
+	object *apiv1beta1.Token,
+	conditionType string,
+	conditionStatus v12.ConditionStatus,
+	reason, message string,
+) {
+	meta.SetStatusCondition(
+		&status.Conditions,
+		v12.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: object.Generation,
+			Reason:             reason,
+			Message:            message,
+		},
+	)
+}
+
+// removeLegacyConditions drops condition types written by earlier versions
+// of the operator
+func removeLegacyConditions(status *apiv1beta1.TokenStatus) {
+	for _, conditionType := range []string{
+		conditionTypeLegacyObject,
+		conditionTypeLegacyInfluxdb,
+	} {
+		meta.RemoveStatusCondition(&status.Conditions, conditionType)
+	}
+}
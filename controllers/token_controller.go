@@ -18,27 +18,62 @@ package controllers
 
 import (
 	"context"
-	"errors"
 	"time"
 
 	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // TokenReconciler reconciles a Token object
 type TokenReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader reads directly from the API server, bypassing the cache
+	APIReader client.Reader
+	// Recorder emits events for the reconciled objects
+	Recorder record.EventRecorder
+	// Clientset is used for subresources such as serviceaccounts/token
+	// that the controller-runtime client does not support
+	Clientset kubernetes.Interface
+	// RootCA is the cluster CA bundle written into issued token secrets
+	RootCA []byte
+	// ProvisioningTimeout is how long to wait for a secret to be populated
+	// with a token before reporting the token as degraded
+	ProvisioningTimeout time.Duration
+	// APIServerURL is the API server URL written into generated kubeconfigs
+	// that do not specify a server
+	APIServerURL string
+	// FreezeRotation suspends the issuance of new tokens for all objects
+	FreezeRotation bool
+	// IssuanceBudget is the number of tokens issued across all objects per
+	// IssuanceBudgetWindow, beyond which overdue rotations are spread out.
+	// Zero does not limit issuances.
+	IssuanceBudget int
+	// IssuanceBudgetWindow is the window the issuance budget applies to
+	IssuanceBudgetWindow time.Duration
+
+	budget *issuanceBudget
 }
 
 //+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=tokens,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=tokens/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=serviceaccount.kubetrail.io,resources=tokens/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -70,23 +105,17 @@ func (r *TokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	// indicated by the deletion timestamp being set.
 	if object.GetDeletionTimestamp() != nil {
 		if err := r.FinalizeStatus(ctx, object); err != nil {
-			if errors.Is(err, ObjectUpdated) {
-				return ctrl.Result{}, nil
-			}
-			return ctrl.Result{}, err
+			return requeueOnConflict(ctx, ctrl.Result{}, err)
 		}
 
-		if err := r.FinalizeResources(ctx, object, req); err != nil {
-			if errors.Is(err, ObjectUpdated) {
-				return ctrl.Result{}, nil
-			}
-			return ctrl.Result{}, err
+		// secrets may need to outlive the object for a while, in which
+		// case the finalizer is kept until the requeue
+		result, err := r.FinalizeResources(ctx, object, req)
+		if err != nil || !result.IsZero() {
+			return result, err
 		}
 
 		if err := r.RemoveFinalizer(ctx, object); err != nil {
-			if errors.Is(err, ObjectUpdated) {
-				return ctrl.Result{}, nil
-			}
 			return ctrl.Result{}, err
 		}
 
@@ -95,36 +124,44 @@ func (r *TokenReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 	// Add finalizer for this CR and update the object.
 	if err := r.AddFinalizer(ctx, object); err != nil {
-		if errors.Is(err, ObjectUpdated) {
-			return ctrl.Result{}, nil
-		}
 		return ctrl.Result{}, err
 	}
 
 	if err := r.InitializeStatus(ctx, object); err != nil {
-		if errors.Is(err, ObjectUpdated) {
-			return ctrl.Result{}, nil
-		}
-		return ctrl.Result{}, err
+		return requeueOnConflict(ctx, ctrl.Result{}, err)
 	}
 
-	if err := r.ReconcileResources(ctx, object, req); err != nil {
-		if errors.Is(err, ObjectUpdated) {
-			return ctrl.Result{}, nil
-		}
-		return ctrl.Result{}, err
-	}
-
-	// requeue to maintain the state
-	return ctrl.Result{
-		Requeue:      true,
-		RequeueAfter: time.Minute,
-	}, nil
+	// requeue at the next rotation, expiry or deletion deadline
+	result, err := r.ReconcileResources(ctx, object, req)
+	return requeueOnConflict(ctx, result, err)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TokenReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.budget = newIssuanceBudget(r.IssuanceBudget, r.IssuanceBudgetWindow)
+
+	if err := r.setupIndexes(mgr); err != nil {
+		return err
+	}
+
+	if err := mgr.Add(manager.RunnableFunc(r.labelLegacySecrets)); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&apiv1beta1.Token{}).
+		Owns(&v1.Secret{}).
+		Watches(
+			&source.Kind{Type: &v1.ServiceAccount{}},
+			handler.EnqueueRequestsFromMapFunc(r.tokensForServiceAccount),
+		).
+		Watches(
+			&source.Kind{Type: &v1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.tokenForReplica),
+		).
+		Watches(
+			&source.Kind{Type: &v1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.tokensForNamespace),
+		).
 		Complete(r)
 }
@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
-
 	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -33,31 +31,104 @@ func (r *TokenReconciler) FinalizeStatus(ctx context.Context, clientObject clien
 	}
 
 	// Update the status of the object if not terminating
-	if object.Status.Phase != phaseTerminating {
-		object.Status = apiv1beta1.TokenStatus{
-			Phase:      phaseTerminating,
-			Conditions: object.Status.Conditions,
-			Message:    "object is marked for deletion",
-			Reason:     reasonObjectMarkedForDeletion,
-		}
-		if err := r.Status().Update(ctx, object); err != nil {
+	status := object.Status.DeepCopy()
+	if status.Phase != phaseTerminating {
+		status.Phase = phaseTerminating
+		status.Message = "object is marked for deletion"
+		status.Reason = reasonObjectMarkedForDeletion
+		status.ObservedGeneration = object.Generation
+		setCondition(
+			status,
+			object,
+			conditionTypeReady,
+			v12.ConditionFalse,
+			reasonObjectMarkedForDeletion,
+			"object is marked for deletion",
+		)
+		if err := r.patchStatus(ctx, object, status); err != nil {
 			reqLogger.Error(err, "failed to update object status")
 			return err
-		} else {
-			reqLogger.Info("updated object status")
-			return ObjectUpdated
 		}
+		reqLogger.Info("updated object status")
 	}
 
 	return nil
 }
 
-func (r *TokenReconciler) FinalizeResources(ctx context.Context, clientObject client.Object, req ctrl.Request) error {
+func (r *TokenReconciler) FinalizeResources(ctx context.Context, clientObject client.Object, req ctrl.Request) (ctrl.Result, error) {
 	if !controllerutil.ContainsFinalizer(clientObject, finalizer) {
-		return nil
+		return ctrl.Result{}, nil
 	}
 
-	return nil
+	reqLogger := log.FromContext(ctx)
+
+	object, ok := clientObject.(*apiv1beta1.Token)
+	if !ok {
+		err := fmt.Errorf("cientObject to object type assertion error")
+		reqLogger.Error(err, "failed to get object instance")
+		return ctrl.Result{}, err
+	}
+
+	secrets, err := r.listSecrets(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list secrets")
+		return ctrl.Result{}, err
+	}
+
+	outputs, err := r.listOutputSecrets(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list output secrets")
+		return ctrl.Result{}, err
+	}
+	secrets = append(secrets, outputs...)
+
+	// copies in other namespaces are not garbage collected
+	replicas, err := r.listReplicas(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list replicas")
+		return ctrl.Result{}, err
+	}
+	secrets = append(secrets, replicas...)
+
+	switch policy := deletionPolicy(object); policy {
+	case apiv1beta1.DeletionPolicyRetain:
+		// retained secrets are useless without their service account
+		if err := r.orphanServiceAccount(ctx, object); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.orphanSecrets(ctx, object, secrets); err != nil {
+			return ctrl.Result{}, err
+		}
+	case apiv1beta1.DeletionPolicyGraceful:
+		// keep the finalizer until the grace period of the newest secret ends
+		if remaining := time.Until(gracefulDeletionTime(object)); remaining > 0 && len(secrets) > 0 {
+			deleteAt := gracefulDeletionTime(object).UTC().Format(time.RFC3339)
+			status := object.Status.DeepCopy()
+			status.Message = fmt.Sprintf(
+				"waiting %s for the deletion grace period, secrets are deleted at %s",
+				remaining.Round(time.Second),
+				deleteAt,
+			)
+			status.Reason = reasonWaitingForGracePeriod
+			if err := r.patchStatus(ctx, object, status); err != nil {
+				reqLogger.Error(err, "failed to update object status")
+				return ctrl.Result{}, err
+			}
+			reqLogger.Info("waiting for deletion grace period", "deleteAt", deleteAt)
+			return ctrl.Result{RequeueAfter: remaining + requeueSafetyMargin}, nil
+		}
+		fallthrough
+	case apiv1beta1.DeletionPolicyDelete:
+		if err := r.deleteSecrets(ctx, secrets); err != nil {
+			return ctrl.Result{}, err
+		}
+	default:
+		err := fmt.Errorf("unsupported deletion policy %q", policy)
+		reqLogger.Error(err, "failed to finalize secrets")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
 }
 
 func (r *TokenReconciler) RemoveFinalizer(ctx context.Context, clientObject client.Object) error {
@@ -67,13 +138,21 @@ func (r *TokenReconciler) RemoveFinalizer(ctx context.Context, clientObject clie
 
 	reqLogger := log.FromContext(ctx)
 
-	controllerutil.RemoveFinalizer(clientObject, finalizer)
-	if err := r.Update(ctx, clientObject); err != nil {
+	object, ok := clientObject.(*apiv1beta1.Token)
+	if !ok {
+		err := fmt.Errorf("cientObject to object type assertion error")
+		reqLogger.Error(err, "failed to get object instance")
+		return err
+	}
+
+	if err := r.patchObject(ctx, r.Client, object, func(latest *apiv1beta1.Token) {
+		controllerutil.RemoveFinalizer(latest, finalizer)
+	}); err != nil {
 		reqLogger.Error(err, "failed to remove finalizer")
 		return err
 	}
 	reqLogger.Info("finalizer removed")
-	return ObjectUpdated
+	return nil
 }
 
 func (r *TokenReconciler) AddFinalizer(ctx context.Context, clientObject client.Object) error {
@@ -83,13 +162,21 @@ func (r *TokenReconciler) AddFinalizer(ctx context.Context, clientObject client.
 
 	reqLogger := log.FromContext(ctx)
 
-	controllerutil.AddFinalizer(clientObject, finalizer)
-	if err := r.Update(ctx, clientObject); err != nil {
+	object, ok := clientObject.(*apiv1beta1.Token)
+	if !ok {
+		err := fmt.Errorf("cientObject to object type assertion error")
+		reqLogger.Error(err, "failed to get object instance")
+		return err
+	}
+
+	if err := r.patchObject(ctx, r.Client, object, func(latest *apiv1beta1.Token) {
+		controllerutil.AddFinalizer(latest, finalizer)
+	}); err != nil {
 		reqLogger.Error(err, "failed to add finalizer")
 		return err
 	}
 	reqLogger.Info("finalizer added")
-	return ObjectUpdated
+	return nil
 }
 
 func (r *TokenReconciler) InitializeStatus(ctx context.Context, clientObject client.Object) error {
@@ -109,231 +196,639 @@ func (r *TokenReconciler) InitializeStatus(ctx context.Context, clientObject cli
 	}
 
 	// Update the status of the object if none exists
-	found := false
-	for _, condition := range object.Status.Conditions {
-		if condition.Reason == reasonFinalizerAdded {
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		object.Status = apiv1beta1.TokenStatus{
-			Phase: phasePending,
-			Conditions: []v12.Condition{
-				{
-					Type:               conditionTypeObject,
-					Status:             v12.ConditionTrue,
-					ObservedGeneration: 0,
-					LastTransitionTime: v12.Time{Time: time.Now()},
-					Reason:             reasonFinalizerAdded,
-					Message:            "object initialized",
-				},
-			},
-			Message: "object initialized",
-			Reason:  reasonObjectInitialized,
-		}
-		if err := r.Status().Update(ctx, object); err != nil {
+	if len(object.Status.Phase) == 0 {
+		status := &apiv1beta1.TokenStatus{
+			Phase:              phasePending,
+			Message:            "object initialized",
+			Reason:             reasonObjectInitialized,
+			ObservedGeneration: object.Generation,
+		}
+		setCondition(
+			status,
+			object,
+			conditionTypeReady,
+			v12.ConditionFalse,
+			reasonObjectInitialized,
+			"object initialized",
+		)
+		if err := r.patchStatus(ctx, object, status); err != nil {
 			reqLogger.Error(err, "failed to update object status")
 			return err
-		} else {
-			reqLogger.Info("updated object status")
-			return ObjectUpdated
 		}
+		reqLogger.Info("updated object status")
 	}
 
 	return nil
 }
 
-func (r *TokenReconciler) ReconcileResources(ctx context.Context, clientObject client.Object, req ctrl.Request) error {
+func (r *TokenReconciler) ReconcileResources(ctx context.Context, clientObject client.Object, req ctrl.Request) (ctrl.Result, error) {
 	reqLogger := log.FromContext(ctx)
 
 	if !controllerutil.ContainsFinalizer(clientObject, finalizer) {
 		err := fmt.Errorf("finalizer not found")
 		reqLogger.Error(err, "failed to detect finalizer")
-		return err
+		return ctrl.Result{}, err
 	}
 
 	object, ok := clientObject.(*apiv1beta1.Token)
 	if !ok {
 		err := fmt.Errorf("cientObject to object type assertion error")
 		reqLogger.Error(err, "failed to get object instance")
-		return err
+		return ctrl.Result{}, err
 	}
 
-	secrets := &v1.SecretList{}
-	if err := r.List(ctx, secrets, client.InNamespace(object.Namespace)); err != nil {
+	secrets, err := r.listSecrets(ctx, object)
+	if err != nil {
 		reqLogger.Error(err, "failed to list secrets")
-		return err
+		return ctrl.Result{}, err
 	}
 
-	// scan through all secrets, find the ones for which owner reference matches, then
-	// delete those for which time has expired
-	for _, secret := range secrets.Items {
+	// delete owned secrets for which time has expired. The current secret is
+	// kept until a new token replaces it, so that an issuance that is deferred
+	// or awaiting verification does not leave the object without a token.
+	var owned []v1.Secret
+	deleted := make(map[string]struct{})
+	for _, secret := range secrets {
 		secret := secret
-		for _, ownerReference := range secret.OwnerReferences {
-			if ownerReference.UID == object.UID &&
-				object.Spec.RotationPeriodSeconds != nil &&
-				object.Spec.DeletionGracePeriodSeconds != nil {
-				if time.Since(
-					secret.CreationTimestamp.Time.Add(
-						time.Second*time.Duration(
-							(*object.Spec.RotationPeriodSeconds)+(*object.Spec.DeletionGracePeriodSeconds),
-						),
-					),
-				) > 0 {
-					if err := r.Delete(ctx, &secret); err != nil {
-						reqLogger.Error(err, "failed to delete secret", "name", secret.Name)
-						return err
-					} else {
-						reqLogger.Info("deleted secret", "name", secret.Name)
-					}
-				}
+		if secret.Name == object.Status.SecretName {
+			owned = append(owned, secret)
+		} else if deleteAt, ok := secretDeleteAt(object, &secret); ok && time.Since(deleteAt) > 0 {
+			if err := r.Delete(ctx, &secret); err != nil {
+				reqLogger.Error(err, "failed to delete secret", "name", secret.Name)
+				return ctrl.Result{}, err
+			} else {
+				reqLogger.Info("deleted secret", "name", secret.Name)
 			}
+			deleted[secret.Name] = struct{}{}
+		} else {
+			owned = append(owned, secret)
 		}
 	}
 
-	id := uuid.New().String()
-	secretName := fmt.Sprintf("%s-%s-%s", object.Name, "token", id[:5])
-	createSecret := func() error {
-		var deletionTimestamp *v12.Time
-		if object.Spec.RotationPeriodSeconds != nil {
-			deletionTimestamp = &v12.Time{
-				Time: time.Now().Add(
-					time.Second * time.Duration(*object.Spec.RotationPeriodSeconds),
-				),
+	// delete owned secrets that were never recorded in the status, which can
+	// be left behind by earlier versions of the operator. Tokens that predate
+	// secret records have their existing secrets adopted instead.
+	if len(object.Status.Secrets) > 0 || len(object.Status.SecretName) == 0 {
+		unrecorded, err := r.unrecordedSecrets(ctx, object, owned)
+		if err != nil {
+			reqLogger.Error(err, "failed to find unrecorded secrets")
+			return ctrl.Result{}, err
+		}
+		for _, secret := range unrecorded {
+			secret := secret
+			if err := r.Delete(ctx, &secret); err != nil && !errors.IsNotFound(err) {
+				reqLogger.Error(err, "failed to delete unrecorded secret", "name", secret.Name)
+				return ctrl.Result{}, err
 			}
+			reqLogger.Info("deleted unrecorded secret", "name", secret.Name)
+			deleted[secret.Name] = struct{}{}
+		}
+	}
+
+	status := object.Status.DeepCopy()
+	status.ObservedGeneration = object.Generation
+	removeLegacyConditions(status)
+
+	// tokens are only issued once the service account exists
+	serviceAccount, err := r.reconcileServiceAccount(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to reconcile service account")
+		return ctrl.Result{}, err
+	}
+
+	if serviceAccount == nil {
+		setCondition(
+			status,
+			object,
+			conditionTypeServiceAccountFound,
+			v12.ConditionFalse,
+			reasonServiceAccountNotFound,
+			fmt.Sprintf("service account %s not found", object.Spec.ServiceAccountName),
+		)
+	} else {
+		setCondition(
+			status,
+			object,
+			conditionTypeServiceAccountFound,
+			v12.ConditionTrue,
+			reasonServiceAccountFound,
+			fmt.Sprintf("service account %s found", object.Spec.ServiceAccountName),
+		)
+	}
+
+	// tokens of a recreated service account are no longer valid, all secrets
+	// are deleted and a new token is issued right away
+	if serviceAccount != nil {
+		if len(status.ServiceAccountUID) > 0 && status.ServiceAccountUID != serviceAccount.UID {
+			r.Recorder.Eventf(
+				object,
+				v1.EventTypeWarning,
+				reasonServiceAccountRecreated,
+				"service account %s was recreated, issuing a new token",
+				serviceAccount.Name,
+			)
+			if err := r.deleteSecrets(ctx, owned); err != nil {
+				return ctrl.Result{}, err
+			}
+			for _, secret := range owned {
+				deleted[secret.Name] = struct{}{}
+			}
+			deleted[status.SecretName] = struct{}{}
+			status.PendingSecretName = ""
+		}
+		status.ServiceAccountUID = serviceAccount.UID
+	}
+
+	// a revocation deletes every secret issued before it right away, including
+	// the current one and its copies, so that a new token is issued even while
+	// suspended
+	revokeAt, revocationDue := requestDue(object, apiv1beta1.AnnotationRevokeAt, status.ObservedRevokeAt)
+	if revocationDue {
+		var remaining []v1.Secret
+		for _, secret := range owned {
+			if _, ok := deleted[secret.Name]; !ok {
+				remaining = append(remaining, secret)
+			}
+		}
+		revoked, err := r.revokeSecrets(ctx, remaining, revokeAt)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		for _, secret := range revoked {
+			deleted[secret.Name] = struct{}{}
+		}
+		if err := r.revokeCopies(ctx, object); err != nil {
+			return ctrl.Result{}, err
+		}
+		status.Replicas = nil
+		if _, ok := deleted[status.PendingSecretName]; ok {
+			status.PendingSecretName = ""
+		}
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonTokenRevoked,
+			"revoked %d secrets issued up to %s, issuing a new token",
+			len(revoked),
+			revokeAt.UTC().Format(time.RFC3339),
+		)
+		status.ObservedRevokeAt = &v12.Time{Time: revokeAt}
+		now := v12.Now().Rfc3339Copy()
+		status.LastRevocationTime = &now
+	}
+
+	// fetch the pending and current secrets, either of which may not exist
+	pending, err := r.getSecret(ctx, object.Namespace, status.PendingSecretName)
+	if err != nil {
+		reqLogger.Error(err, "failed to get pending secret")
+		return ctrl.Result{}, err
+	}
+
+	current, err := r.getSecret(ctx, object.Namespace, status.SecretName)
+	if err != nil {
+		reqLogger.Error(err, "failed to get secret")
+		return ctrl.Result{}, err
+	}
+
+	if _, ok := deleted[status.SecretName]; ok {
+		current = nil
+	} else if current == nil && len(status.SecretName) > 0 {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretMissing,
+			"secret %s was deleted outside the operator, issuing a new token",
+			status.SecretName,
+		)
+	}
+
+	// detect changes made to the current secret outside the operator
+	if current != nil && secretPopulated(current) {
+		if current, err = r.reconcileDrift(ctx, object, current); err != nil {
+			reqLogger.Error(err, "failed to reconcile secret drift")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// a current secret that was never populated is awaited like a pending one
+	if pending == nil && current != nil && !secretPopulated(current) {
+		pending, current = current, nil
+	}
+
+	// a pending token that still fails verification once the provisioning
+	// timeout has passed is discarded, and a new token is issued in its place
+	discarded := false
+	if pending != nil && secretPopulated(pending) &&
+		verificationTimedOut(status, r.ProvisioningTimeout) {
+		if err := r.Delete(ctx, pending); err != nil && !errors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to delete secret", "name", pending.Name)
+			return ctrl.Result{}, err
 		}
-		return r.Create(
-			ctx,
-			&v1.Secret{
-				TypeMeta: v12.TypeMeta{},
-				ObjectMeta: v12.ObjectMeta{
-					Name:                       secretName,
-					GenerateName:               "",
-					Namespace:                  object.Namespace,
-					SelfLink:                   "",
-					UID:                        "",
-					ResourceVersion:            "",
-					Generation:                 0,
-					CreationTimestamp:          v12.Time{Time: time.Now()},
-					DeletionTimestamp:          deletionTimestamp,
-					DeletionGracePeriodSeconds: object.Spec.DeletionGracePeriodSeconds,
-					Labels:                     nil,
-					Annotations: map[string]string{
-						v1.ServiceAccountNameKey: object.Spec.ServiceAccountName,
-					},
-					OwnerReferences: []v12.OwnerReference{
-						{
-							APIVersion:         object.APIVersion,
-							Kind:               object.Kind,
-							Name:               object.Name,
-							UID:                object.UID,
-							Controller:         nil,
-							BlockOwnerDeletion: nil,
-						},
-					},
-					Finalizers:    nil,
-					ClusterName:   "",
-					ManagedFields: nil,
-				},
-				Immutable:  nil,
-				Data:       nil,
-				StringData: nil,
-				Type:       "kubernetes.io/service-account-token",
-			},
+		reqLogger.Info("deleted secret", "name", pending.Name)
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonTokenDiscarded,
+			"discarded token in secret %s that failed verification within %s, issuing a new token",
+			pending.Name,
+			r.ProvisioningTimeout,
+		)
+		deleted[pending.Name] = struct{}{}
+		pending = nil
+		status.PendingSecretName = ""
+		status.PendingVerificationFailedAt = nil
+		discarded = true
+	}
+
+	// a requested rotation issues a single new token, unless one is already
+	// being provisioned
+	rotateAt, rotateRequestDue := requestDue(object, apiv1beta1.AnnotationRotateAt, status.ObservedRotateAt)
+	rotationRequested := rotateRequestDue && current != nil
+	issuanceDue := serviceAccount != nil && pending == nil && len(status.PendingSecretName) == 0 &&
+		(current == nil || rotationDue(object, current) || rotationRequested || discarded)
+
+	// while suspended no new tokens are issued and a requested rotation is
+	// kept until the token is resumed
+	suspendedReason, suspendedMessage := r.suspension(object)
+	suspended := len(suspendedReason) > 0
+
+	// overdue rotations are spread out by the issuance budget, while objects
+	// without a current token or with one expiring soon are issued right away
+	var budgetWait time.Duration
+	if issuanceDue && !suspended {
+		if wait, ok := r.budget.take(current == nil || expiringSoon(object, current)); !ok {
+			budgetWait = wait
+			reqLogger.Info("waiting for issuance budget", "wait", wait)
+		}
+	}
+	deferred := issuanceDue && !revocationDue && (suspended || budgetWait > 0)
+
+	if rotateRequestDue && serviceAccount != nil && !deferred {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeNormal,
+			reasonRotationRequested,
+			"rotation requested at %s",
+			rotateAt.UTC().Format(time.RFC3339),
 		)
+		status.ObservedRotateAt = &v12.Time{Time: rotateAt}
 	}
 
-	var tokenCreated bool
-	// try to get secret associated with the service account
-	// if secret is found, do nothing
-	// if it is not found, create one
-	// report errors if not these two cases
-	secret := &v1.Secret{}
-	if err := r.Get(
-		ctx,
-		types.NamespacedName{
-			Namespace: req.Namespace,
-			Name:      object.Status.SecretName,
-		},
-		secret,
-	); err != nil {
-		if errors.IsNotFound(err) {
-			if err := createSecret(); err != nil {
+	// issue a new token if there is no current secret, if it is due for
+	// rotation or if a rotation was requested, unless a previously issued
+	// token is still being provisioned.
+	// The name of the secret is recorded in the status before the secret is
+	// created, so that a secret is never created without being tracked.
+	if issuanceDue && !deferred {
+		status.IssuedCount++
+		status.PendingSecretName = secretNameFor(object, status.IssuedCount)
+		if err := r.patchStatus(ctx, object, status); err != nil {
+			reqLogger.Error(err, "failed to update object status")
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("recorded pending secret", "name", status.PendingSecretName)
+	}
+
+	// create the recorded secret, adopting it if it already exists
+	if serviceAccount != nil && pending == nil && len(status.PendingSecretName) > 0 {
+		if pending, err = r.createSecret(ctx, object, status.PendingSecretName); err != nil {
+			if !errors.IsAlreadyExists(err) {
 				reqLogger.Error(err, "failed to create secret")
-				return err
+				return ctrl.Result{}, err
+			}
+			if pending, err = r.adoptSecret(ctx, object, status.PendingSecretName); err != nil {
+				reqLogger.Error(err, "failed to adopt secret")
+				return ctrl.Result{}, err
 			}
-			tokenCreated = true
 		} else {
-			reqLogger.Error(err, "failed to get secret")
-			return err
+			reqLogger.Info("created secret", "name", status.PendingSecretName)
 		}
-	} else {
-		if object.Spec.RotationPeriodSeconds != nil {
-			if time.Since(
-				secret.CreationTimestamp.Time.Add(
-					time.Second*time.Duration(*object.Spec.RotationPeriodSeconds),
-				),
-			) > 0 {
-				if err := createSecret(); err != nil {
-					reqLogger.Error(err, "failed to create secret")
-					return err
-				}
-				tokenCreated = true
-				if object.Spec.DeletionGracePeriodSeconds == nil {
-					if err := r.Delete(ctx, secret); err != nil {
-						reqLogger.Error(err, "failed to delete secret")
-						return err
-					}
+	}
+
+	// a secret created for a token bound to it is populated once it exists,
+	// which is retried if the token request failed after its creation
+	if serviceAccount != nil && pending != nil && !secretPopulated(pending) &&
+		tokenMode(object) == apiv1beta1.TokenModeTokenRequest && pending.Type == v1.SecretTypeOpaque {
+		name := pending.Name
+		if pending, err = r.populateSecret(ctx, object, pending); err != nil {
+			reqLogger.Error(err, "failed to populate secret", "name", name)
+			return ctrl.Result{}, err
+		}
+		reqLogger.Info("populated secret", "name", name)
+	}
+
+	if pending != nil || serviceAccount != nil {
+		status.PendingSecretName = ""
+	}
+	// with verified rotations a new token only becomes current once it passes
+	// a token review, while the current token stays in place
+	var verificationFailure string
+	if pending != nil && secretPopulated(pending) &&
+		rotationStrategy(object) == apiv1beta1.RotationStrategyVerified {
+		if verificationFailure, err = r.verifyToken(ctx, object, pending); err != nil {
+			reqLogger.Error(err, "failed to verify token", "name", pending.Name)
+			return ctrl.Result{}, err
+		}
+		if len(verificationFailure) > 0 {
+			r.Recorder.Event(object, v1.EventTypeWarning, reasonTokenVerificationFailed, verificationFailure)
+			if status.PendingVerificationFailedAt == nil {
+				now := v12.Now().Rfc3339Copy()
+				status.PendingVerificationFailedAt = &now
+			}
+		}
+	}
+	if len(verificationFailure) == 0 {
+		status.PendingVerificationFailedAt = nil
+	}
+
+	if pending != nil {
+		if secretPopulated(pending) && len(verificationFailure) == 0 {
+			// promote pending secret to be the current secret
+			if current != nil && (object.Spec.DeletionGracePeriodSeconds == nil ||
+				rotationStrategy(object) == apiv1beta1.RotationStrategyImmediate) {
+				if err := r.Delete(ctx, current); err != nil && !errors.IsNotFound(err) {
+					reqLogger.Error(err, "failed to delete secret", "name", current.Name)
+					return ctrl.Result{}, err
 				}
+				reqLogger.Info("deleted secret", "name", current.Name)
+				deleted[current.Name] = struct{}{}
 			}
+			current, pending = pending, nil
+			status.Message = "created serviceaccount token"
+			status.Reason = reasonCreatedToken
+			now := v12.Now().Rfc3339Copy()
+			status.LastRotationTime = &now
+		} else {
+			status.PendingSecretName = pending.Name
 		}
 	}
 
-	if tokenCreated {
-		condition := v12.Condition{
-			Type:               conditionTypeInfluxdb,
-			Status:             v12.ConditionTrue,
-			ObservedGeneration: 0,
-			LastTransitionTime: v12.Time{Time: time.Now()},
-			Reason:             reasonCreatedToken,
-			Message:            "created serviceaccount token",
+	// write the additional formats of the current token. Outputs that fail to
+	// render are reported until the object is changed rather than retried.
+	var outputFailure string
+	if serviceAccount != nil && current != nil && secretPopulated(current) {
+		updated, err := r.reconcileOutputs(ctx, object, current)
+		if isOutputError(err) {
+			outputFailure = err.Error()
+			r.Recorder.Event(object, v1.EventTypeWarning, reasonOutputRenderFailed, outputFailure)
+		} else if err != nil {
+			reqLogger.Error(err, "failed to reconcile outputs")
+			return ctrl.Result{}, err
 		}
+		current = updated
 
-		conditions := object.Status.Conditions
+		if status.Replicas, err = r.reconcileReplicas(ctx, object, current); err != nil {
+			reqLogger.Error(err, "failed to reconcile replicas")
+			return ctrl.Result{}, err
+		}
+	}
 
-		index := -1
-		for i, condition := range object.Status.Conditions {
-			if condition.Type == conditionTypeInfluxdb &&
-				condition.Status == v12.ConditionTrue &&
-				condition.Reason == reasonCreatedToken {
-				index = i
-				break
-			}
+	// record the lifecycle of every secret issued for the object
+	var observed []v1.Secret
+	for _, secret := range owned {
+		if _, ok := deleted[secret.Name]; !ok {
+			observed = append(observed, secret)
 		}
+	}
+	status.Secrets = secretStatuses(object, status.Secrets, current, pending, observed)
 
-		if index >= 0 {
-			conditions[index] = condition
-		} else {
-			conditions = append(conditions, condition)
+	status.NextRotationTime = nil
+	if current != nil {
+		if rotateAt := nextRotationTime(object, current); !rotateAt.IsZero() {
+			status.NextRotationTime = &v12.Time{Time: rotateAt}
 		}
+	}
 
-		object.Status = apiv1beta1.TokenStatus{
-			Phase:      phaseReady,
-			Conditions: conditions,
-			Message:    "created serviceaccount token",
-			Reason:     reasonCreatedToken,
-			SecretName: secretName,
+	// the token is only ready once the current secret holds a token of an
+	// existing service account
+	if serviceAccount == nil {
+		status.Phase = phasePending
+		status.Message = fmt.Sprintf("waiting for service account %s", object.Spec.ServiceAccountName)
+		status.Reason = reasonServiceAccountNotFound
+		setCondition(
+			status,
+			object,
+			conditionTypeReady,
+			v12.ConditionFalse,
+			reasonServiceAccountNotFound,
+			fmt.Sprintf("service account %s not found", object.Spec.ServiceAccountName),
+		)
+	} else if current != nil && secretPopulated(current) {
+		status.Phase = phaseReady
+		status.SecretName = current.Name
+		setCondition(
+			status,
+			object,
+			conditionTypeReady,
+			v12.ConditionTrue,
+			reasonTokenPopulated,
+			fmt.Sprintf("secret %s is populated with a token", current.Name),
+		)
+	} else {
+		status.Phase = phaseProvisioning
+		status.SecretName = ""
+		status.Message = "waiting for secret to be populated with a token"
+		status.Reason = reasonProvisioningToken
+		setCondition(
+			status,
+			object,
+			conditionTypeReady,
+			v12.ConditionFalse,
+			reasonProvisioningToken,
+			"waiting for secret to be populated with a token",
+		)
+	}
+
+	if pending != nil && len(verificationFailure) > 0 {
+		setCondition(
+			status,
+			object,
+			conditionTypeRotating,
+			v12.ConditionTrue,
+			reasonTokenRotating,
+			fmt.Sprintf("waiting for the token in secret %s to pass verification", pending.Name),
+		)
+	} else if pending != nil {
+		setCondition(
+			status,
+			object,
+			conditionTypeRotating,
+			v12.ConditionTrue,
+			reasonTokenRotating,
+			fmt.Sprintf("waiting for secret %s to be populated with a token", pending.Name),
+		)
+	} else if budgetWait > 0 {
+		setCondition(
+			status,
+			object,
+			conditionTypeRotating,
+			v12.ConditionTrue,
+			reasonWaitingForIssuanceBudget,
+			"waiting for the issuance budget to issue a new token",
+		)
+	} else {
+		setCondition(
+			status,
+			object,
+			conditionTypeRotating,
+			v12.ConditionFalse,
+			reasonTokenRotated,
+			"no token rotation in progress",
+		)
+	}
+
+	if err := rotationScheduleError(object); err != nil {
+		setCondition(
+			status,
+			object,
+			conditionTypeDegraded,
+			v12.ConditionTrue,
+			reasonInvalidRotationSchedule,
+			err.Error(),
+		)
+	} else if len(verificationFailure) > 0 {
+		setCondition(
+			status,
+			object,
+			conditionTypeDegraded,
+			v12.ConditionTrue,
+			reasonTokenVerificationFailed,
+			verificationFailure,
+		)
+	} else if len(outputFailure) > 0 {
+		setCondition(
+			status,
+			object,
+			conditionTypeDegraded,
+			v12.ConditionTrue,
+			reasonOutputRenderFailed,
+			outputFailure,
+		)
+	} else if pending != nil && time.Since(pending.CreationTimestamp.Time) > r.ProvisioningTimeout {
+		setCondition(
+			status,
+			object,
+			conditionTypeDegraded,
+			v12.ConditionTrue,
+			reasonTokenNotPopulated,
+			fmt.Sprintf(
+				"secret %s was not populated with %s, %s and %s within %s",
+				pending.Name,
+				v1.ServiceAccountTokenKey,
+				v1.ServiceAccountRootCAKey,
+				v1.ServiceAccountNamespaceKey,
+				r.ProvisioningTimeout,
+			),
+		)
+	} else {
+		setCondition(
+			status,
+			object,
+			conditionTypeDegraded,
+			v12.ConditionFalse,
+			reasonTokenPopulated,
+			"secrets are populated within the provisioning timeout",
+		)
+	}
+
+	// a deferred issuance is counted and reported once, when it is first deferred
+	switch {
+	case suspended && issuanceDue:
+		if !rotationDeferred(object) {
+			deferredRotations.Inc()
+			r.Recorder.Eventf(
+				object,
+				v1.EventTypeNormal,
+				reasonRotationDeferred,
+				"issuance of a new token deferred, %s",
+				suspendedMessage,
+			)
 		}
-		if err := r.Status().Update(ctx, object); err != nil {
+		setCondition(
+			status,
+			object,
+			conditionTypeSuspended,
+			v12.ConditionTrue,
+			reasonRotationDeferred,
+			fmt.Sprintf("issuance of a new token is deferred, %s", suspendedMessage),
+		)
+	case suspended:
+		setCondition(
+			status,
+			object,
+			conditionTypeSuspended,
+			v12.ConditionTrue,
+			suspendedReason,
+			suspendedMessage,
+		)
+	default:
+		setCondition(
+			status,
+			object,
+			conditionTypeSuspended,
+			v12.ConditionFalse,
+			reasonNotSuspended,
+			"token issuance is not suspended",
+		)
+	}
+
+	if expiry, ok := secretExpiry(object, current); ok && time.Until(expiry) < expiringSoonThreshold {
+		setCondition(
+			status,
+			object,
+			conditionTypeExpiringSoon,
+			v12.ConditionTrue,
+			reasonTokenExpiringSoon,
+			fmt.Sprintf("token in secret %s expires at %s", current.Name, expiry.UTC().Format(time.RFC3339)),
+		)
+	} else {
+		setCondition(
+			status,
+			object,
+			conditionTypeExpiringSoon,
+			v12.ConditionFalse,
+			reasonTokenNotExpiring,
+			"token is not expiring soon",
+		)
+	}
+
+	if !equality.Semantic.DeepEqual(&object.Status, status) {
+		if err := r.patchStatus(ctx, object, status); err != nil {
 			reqLogger.Error(err, "failed to update object status")
-			return err
-		} else {
-			reqLogger.Info("updated object status")
-			return ObjectUpdated
+			return ctrl.Result{}, err
 		}
+		reqLogger.Info("updated object status")
 	}
 
-	return nil
+	// requeue at the earliest upcoming deadline of the owned secrets
+	next := &deadline{}
+	for _, secret := range owned {
+		secret := secret
+		if deleteAt, ok := secretDeleteAt(object, &secret); ok {
+			next.add(deleteAt)
+		}
+	}
+	if current != nil {
+		next.add(nextRotationTime(object, current))
+		if expiry, ok := secretExpiry(object, current); ok {
+			next.add(expiry.Add(-expiringSoonThreshold))
+		}
+	}
+	if pending != nil {
+		next.add(pending.CreationTimestamp.Time.Add(r.ProvisioningTimeout))
+	}
+	if budgetWait > 0 {
+		next.add(time.Now().Add(budgetWait))
+	}
+	if len(verificationFailure) > 0 {
+		next.add(time.Now().Add(verificationRetryPeriod))
+		next.add(status.PendingVerificationFailedAt.Time.Add(r.ProvisioningTimeout))
+	}
+	for _, annotation := range []string{apiv1beta1.AnnotationRotateAt, apiv1beta1.AnnotationRevokeAt} {
+		if requestedAt, ok := requestTime(object, annotation); ok {
+			next.add(requestedAt)
+		}
+	}
+
+	return next.result(), nil
 }
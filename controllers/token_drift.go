@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// secretChecksum hashes the token data and the annotations describing it,
+// so that changes made outside the operator can be detected
+func secretChecksum(secret *v1.Secret) string {
+	hash := sha256.New()
+	for _, value := range [][]byte{
+		secret.Data[v1.ServiceAccountTokenKey],
+		secret.Data[v1.ServiceAccountRootCAKey],
+		secret.Data[v1.ServiceAccountNamespaceKey],
+		[]byte(secret.Annotations[v1.ServiceAccountNameKey]),
+		[]byte(secret.Annotations[annotationExpirationTimestamp]),
+	} {
+		hash.Write(value)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// reconcileDrift compares the current secret against what the operator wrote.
+// Secrets whose token was tampered with are deleted so that a new token gets
+// issued, in which case nil is returned. Missing metadata is repaired in place.
+func (r *TokenReconciler) reconcileDrift(ctx context.Context, object *apiv1beta1.Token, secret *v1.Secret) (*v1.Secret, error) {
+	reqLogger := log.FromContext(ctx)
+
+	recorded, ok := secret.Annotations[annotationChecksum]
+	tampered := ok && recorded != secretChecksum(secret)
+
+	// a secret controlled by another object can no longer be trusted
+	updated := secret.DeepCopy()
+	repaired := false
+	if !v12.IsControlledBy(secret, object) {
+		if err := controllerutil.SetControllerReference(object, updated, r.Scheme); err != nil {
+			var alreadyOwnedError *controllerutil.AlreadyOwnedError
+			if !errors.As(err, &alreadyOwnedError) {
+				return nil, err
+			}
+			tampered = true
+		}
+
+		// secrets created by earlier versions of the operator carry a plain
+		// owner reference, only a missing reference is considered drift
+		repaired = !hasOwnerReference(secret, object)
+	}
+
+	if tampered {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretModified,
+			"secret %s was modified outside the operator, issuing a new token",
+			secret.Name,
+		)
+		if err := r.Delete(ctx, secret); err != nil && !apimachineryerrors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to delete secret", "name", secret.Name)
+			return nil, err
+		}
+		reqLogger.Info("deleted modified secret", "name", secret.Name)
+		return nil, nil
+	}
+
+	// secrets populated by the kube token controller are checksummed once
+	// they are first observed with a token
+	if !ok {
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		updated.Annotations[annotationChecksum] = secretChecksum(updated)
+	}
+
+	// secrets without the label are not visible through the cache
+	if updated.Labels[labelManagedBy] != managedBy {
+		if updated.Labels == nil {
+			updated.Labels = make(map[string]string)
+		}
+		updated.Labels[labelManagedBy] = managedBy
+	}
+
+	if equality.Semantic.DeepEqual(secret, updated) {
+		return secret, nil
+	}
+
+	if err := r.Update(ctx, updated); err != nil {
+		reqLogger.Error(err, "failed to update secret", "name", secret.Name)
+		return nil, err
+	}
+
+	if repaired {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretRepaired,
+			"secret %s was modified outside the operator, restored owner reference",
+			secret.Name,
+		)
+	}
+
+	return updated, nil
+}
+
+// hasOwnerReference checks if the secret references the object as an owner
+func hasOwnerReference(secret *v1.Secret, object *apiv1beta1.Token) bool {
+	for _, ownerReference := range secret.OwnerReferences {
+		if ownerReference.UID == object.UID {
+			return true
+		}
+	}
+	return false
+}
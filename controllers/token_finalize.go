@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// deletionPolicy returns the deletion policy of the object. Objects created
+// before policies were introduced relied on garbage collection, which is
+// equivalent to Delete.
+func deletionPolicy(object *apiv1beta1.Token) apiv1beta1.DeletionPolicy {
+	if len(object.Spec.DeletionPolicy) == 0 {
+		return apiv1beta1.DeletionPolicyDelete
+	}
+	return object.Spec.DeletionPolicy
+}
+
+// gracefulDeletionTime returns the time the secrets of a deleted object are
+// removed under the Graceful policy. The newest secret is retired when the
+// object is deleted and is kept for the deletion grace period from then on.
+func gracefulDeletionTime(object *apiv1beta1.Token) time.Time {
+	if object.DeletionTimestamp == nil || object.Spec.DeletionGracePeriodSeconds == nil {
+		return time.Time{}
+	}
+
+	return object.DeletionTimestamp.Time.Add(
+		time.Second * time.Duration(*object.Spec.DeletionGracePeriodSeconds),
+	)
+}
+
+// listSecrets returns the issued secrets owned by the object, including the
+// current and pending secrets which may not have reached the cache yet
+func (r *TokenReconciler) listSecrets(ctx context.Context, object *apiv1beta1.Token) ([]v1.Secret, error) {
+	secrets := &v1.SecretList{}
+	if err := r.List(
+		ctx,
+		secrets,
+		client.InNamespace(object.Namespace),
+		client.MatchingFields{indexOwnerUID: string(object.UID)},
+	); err != nil {
+		return nil, err
+	}
+
+	var issued []v1.Secret
+	listed := make(map[string]struct{})
+	for _, secret := range secrets.Items {
+		if !isOutputSecret(&secret) {
+			issued = append(issued, secret)
+			listed[secret.Name] = struct{}{}
+		}
+	}
+
+	for _, name := range []string{object.Status.SecretName, object.Status.PendingSecretName} {
+		if _, ok := listed[name]; ok || len(name) == 0 {
+			continue
+		}
+		secret, err := r.getSecret(ctx, object.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if secret != nil && hasOwnerReference(secret, object) {
+			issued = append(issued, *secret)
+			listed[name] = struct{}{}
+		}
+	}
+
+	return issued, nil
+}
+
+// deleteSecrets deletes the given secrets
+func (r *TokenReconciler) deleteSecrets(ctx context.Context, secrets []v1.Secret) error {
+	reqLogger := log.FromContext(ctx)
+
+	for _, secret := range secrets {
+		secret := secret
+		if err := r.Delete(ctx, &secret); err != nil && !errors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to delete secret", "name", secret.Name)
+			return err
+		}
+		reqLogger.Info("deleted secret", "name", secret.Name)
+	}
+
+	return nil
+}
+
+// orphanSecrets removes the owner reference to the object and the managed by
+// label from the given secrets, so that they outlive the object
+func (r *TokenReconciler) orphanSecrets(ctx context.Context, object *apiv1beta1.Token, secrets []v1.Secret) error {
+	reqLogger := log.FromContext(ctx)
+
+	for _, secret := range secrets {
+		secret := secret
+		patch := client.MergeFrom(secret.DeepCopy())
+
+		var ownerReferences []v12.OwnerReference
+		for _, ownerReference := range secret.OwnerReferences {
+			if ownerReference.UID != object.UID {
+				ownerReferences = append(ownerReferences, ownerReference)
+			}
+		}
+		secret.OwnerReferences = ownerReferences
+		delete(secret.Labels, labelManagedBy)
+
+		if err := r.Patch(ctx, &secret, patch, client.FieldOwner(fieldOwner)); err != nil && !errors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to orphan secret", "name", secret.Name)
+			return err
+		}
+		reqLogger.Info("orphaned secret", "name", secret.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+)
+
+var _ = Describe("Token deletion policy", func() {
+	// deleteTestToken creates a token with the given deletion policy and two
+	// issued secrets, and deletes it while the finalizer holds it in place
+	deleteTestToken := func(name string, policy apiv1beta1.DeletionPolicy, graceSeconds *int64) (*apiv1beta1.Token, []v1.Secret) {
+		r := newTestReconciler()
+		object := createTestToken(ctx, name)
+		object.Spec.DeletionPolicy = policy
+		object.Spec.DeletionGracePeriodSeconds = graceSeconds
+		Expect(k8sClient.Update(ctx, object)).To(Succeed())
+		Expect(r.AddFinalizer(ctx, object)).To(Succeed())
+
+		secrets := []v1.Secret{
+			*createTestSecret(ctx, object, name+"-previous"),
+			*createTestSecret(ctx, object, name+"-current"),
+		}
+		Eventually(func() ([]v1.Secret, error) {
+			return r.listSecrets(ctx, object)
+		}).Should(HaveLen(len(secrets)))
+
+		Expect(k8sClient.Delete(ctx, object)).To(Succeed())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(object), object)).To(Succeed())
+		Expect(object.DeletionTimestamp).NotTo(BeNil())
+
+		return object, secrets
+	}
+
+	// secretsExist returns whether each of the secrets still exists along
+	// with the owner references of those that do
+	secretsExist := func(secrets []v1.Secret) ([]bool, [][]v12.OwnerReference) {
+		var exist []bool
+		var owners [][]v12.OwnerReference
+		for _, secret := range secrets {
+			latest := &v1.Secret{}
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&secret), latest)
+			if errors.IsNotFound(err) {
+				exist = append(exist, false)
+				continue
+			}
+			Expect(err).NotTo(HaveOccurred())
+			exist = append(exist, true)
+			owners = append(owners, latest.OwnerReferences)
+		}
+		return exist, owners
+	}
+
+	It("deletes the secrets with the Delete policy", func() {
+		object, secrets := deleteTestToken("policy-delete", apiv1beta1.DeletionPolicyDelete, nil)
+
+		result, err := newTestReconciler().FinalizeResources(ctx, object, ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IsZero()).To(BeTrue())
+
+		exist, _ := secretsExist(secrets)
+		Expect(exist).To(Equal([]bool{false, false}))
+	})
+
+	It("orphans the secrets with the Retain policy", func() {
+		object, secrets := deleteTestToken("policy-retain", apiv1beta1.DeletionPolicyRetain, nil)
+
+		result, err := newTestReconciler().FinalizeResources(ctx, object, ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IsZero()).To(BeTrue())
+
+		exist, owners := secretsExist(secrets)
+		Expect(exist).To(Equal([]bool{true, true}))
+		for _, ownerReferences := range owners {
+			Expect(ownerReferences).To(BeEmpty())
+		}
+	})
+
+	It("keeps the secrets for the grace period with the Graceful policy", func() {
+		grace := int64(3600)
+		object, secrets := deleteTestToken("policy-graceful", apiv1beta1.DeletionPolicyGraceful, &grace)
+
+		result, err := newTestReconciler().FinalizeResources(ctx, object, ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 59*time.Minute))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour+requeueSafetyMargin))
+
+		exist, _ := secretsExist(secrets)
+		Expect(exist).To(Equal([]bool{true, true}))
+
+		latest := &apiv1beta1.Token{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(object), latest)).To(Succeed())
+		Expect(latest.Status.Reason).To(Equal(reasonWaitingForGracePeriod))
+	})
+
+	It("deletes the secrets once the grace period has passed with the Graceful policy", func() {
+		grace := int64(0)
+		object, secrets := deleteTestToken("policy-graceful-passed", apiv1beta1.DeletionPolicyGraceful, &grace)
+
+		result, err := newTestReconciler().FinalizeResources(ctx, object, ctrl.Request{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.IsZero()).To(BeTrue())
+
+		exist, _ := secretsExist(secrets)
+		Expect(exist).To(Equal([]bool{false, false}))
+	})
+})
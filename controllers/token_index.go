@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SecretSelector selects the secrets managed by the operator. The manager
+// cache is restricted to these secrets so that the data of unrelated secrets
+// is never held in memory.
+func SecretSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{labelManagedBy: managedBy})
+}
+
+// ownerTokenUIDs returns the UIDs of the tokens owning the secret
+func ownerTokenUIDs(object client.Object) []string {
+	var uids []string
+	for _, ownerReference := range object.GetOwnerReferences() {
+		groupVersion, err := schema.ParseGroupVersion(ownerReference.APIVersion)
+		if err != nil {
+			continue
+		}
+		if groupVersion.Group == apiv1beta1.GroupVersion.Group && ownerReference.Kind == "Token" {
+			uids = append(uids, string(ownerReference.UID))
+		}
+	}
+	return uids
+}
+
+// labelLegacySecrets adds the managed by label to secrets owned by tokens
+// that were created before the label was introduced. It runs once on startup
+// and reads through the API server, since such secrets are not cached. Only
+// the metadata of secrets is listed, in pages, so that the data of unrelated
+// secrets is never read. Failures are logged rather than returned, so that
+// they do not stop the manager, and secrets left unlabeled are labeled on the
+// next startup.
+func (r *TokenReconciler) labelLegacySecrets(ctx context.Context) error {
+	reqLogger := log.FromContext(ctx).WithName("label-legacy-secrets")
+
+	continueToken := ""
+	for {
+		secrets := &v12.PartialObjectMetadataList{}
+		secrets.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("SecretList"))
+		if err := r.APIReader.List(
+			ctx,
+			secrets,
+			client.Limit(legacySecretsPageSize),
+			client.Continue(continueToken),
+		); err != nil {
+			reqLogger.Error(err, "failed to list secrets")
+			return nil
+		}
+
+		for _, secret := range secrets.Items {
+			secret := secret
+			if len(ownerTokenUIDs(&secret)) == 0 || secret.Labels[labelManagedBy] == managedBy {
+				continue
+			}
+
+			patch := client.MergeFrom(secret.DeepCopy())
+			if secret.Labels == nil {
+				secret.Labels = make(map[string]string)
+			}
+			secret.Labels[labelManagedBy] = managedBy
+			if err := r.Patch(ctx, &secret, patch); err != nil {
+				reqLogger.Error(err, "failed to label secret", "namespace", secret.Namespace, "name", secret.Name)
+				continue
+			}
+			reqLogger.Info("labeled secret", "namespace", secret.Namespace, "name", secret.Name)
+		}
+
+		if continueToken = secrets.Continue; len(continueToken) == 0 {
+			return nil
+		}
+	}
+}
+
+// tokenServiceAccountName returns the name of the service account of the token
+func tokenServiceAccountName(object client.Object) []string {
+	token, ok := object.(*apiv1beta1.Token)
+	if !ok || len(token.Spec.ServiceAccountName) == 0 {
+		return nil
+	}
+	return []string{token.Spec.ServiceAccountName}
+}
+
+// tokensForServiceAccount maps a service account to reconcile requests for
+// the tokens referencing it
+func (r *TokenReconciler) tokensForServiceAccount(object client.Object) []reconcile.Request {
+	tokens := &apiv1beta1.TokenList{}
+	if err := r.List(
+		context.Background(),
+		tokens,
+		client.InNamespace(object.GetNamespace()),
+		client.MatchingFields{indexServiceAccountName: object.GetName()},
+	); err != nil {
+		ctrl.Log.WithName("tokens-for-service-account").Error(
+			err,
+			"failed to list tokens",
+			"namespace", object.GetNamespace(),
+			"name", object.GetName(),
+		)
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(tokens.Items))
+	for _, token := range tokens.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: token.Namespace,
+				Name:      token.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// setupIndexes registers the field indexes used by the reconciler
+func (r *TokenReconciler) setupIndexes(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(
+		context.Background(),
+		&v1.Secret{},
+		indexOwnerUID,
+		ownerTokenUIDs,
+	); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(
+		context.Background(),
+		&v1.Secret{},
+		indexReplicaOf,
+		secretReplicaOf,
+	); err != nil {
+		return err
+	}
+
+	return mgr.GetFieldIndexer().IndexField(
+		context.Background(),
+		&apiv1beta1.Token{},
+		indexServiceAccountName,
+		tokenServiceAccountName,
+	)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// tokenMode returns the issuance mode of the object. Objects created before
+// modes were introduced have no mode and continue to use legacy secrets.
+func tokenMode(object *apiv1beta1.Token) apiv1beta1.TokenMode {
+	if len(object.Spec.Mode) == 0 {
+		return apiv1beta1.TokenModeLegacySecret
+	}
+	return object.Spec.Mode
+}
+
+// tokenExpirationSeconds is the lifetime requested for a bound token issued
+// now. It covers the time until the rotation and the grace period that
+// follows it, and is at least the minimum lifetime of bound tokens.
+func tokenExpirationSeconds(object *apiv1beta1.Token) *int64 {
+	now := time.Now()
+	rotateAt := rotationTimeFrom(object, now)
+	if rotateAt.IsZero() {
+		return nil
+	}
+
+	expirationSeconds := int64(math.Ceil(rotateAt.Sub(now).Seconds()))
+	if object.Spec.DeletionGracePeriodSeconds != nil {
+		expirationSeconds += *object.Spec.DeletionGracePeriodSeconds
+	}
+	if expirationSeconds < minTokenExpirationSeconds {
+		expirationSeconds = minTokenExpirationSeconds
+	}
+	return &expirationSeconds
+}
+
+// createSecret issues a new token for the object and stores it in a secret
+// with the given name
+func (r *TokenReconciler) createSecret(ctx context.Context, object *apiv1beta1.Token, secretName string) (*v1.Secret, error) {
+	secret := &v1.Secret{
+		ObjectMeta: v12.ObjectMeta{
+			Name:      secretName,
+			Namespace: object.Namespace,
+			Labels: map[string]string{
+				labelManagedBy: managedBy,
+			},
+			Annotations: map[string]string{
+				v1.ServiceAccountNameKey: object.Spec.ServiceAccountName,
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(object, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	switch mode := tokenMode(object); mode {
+	case apiv1beta1.TokenModeLegacySecret:
+		secret.Type = v1.SecretTypeServiceAccountToken
+	case apiv1beta1.TokenModeTokenRequest:
+		secret.Type = v1.SecretTypeOpaque
+		// tokens without a bound object are bound to their own secret, which
+		// needs to exist first, so that deleting the secret revokes the token
+		if object.Spec.BoundObjectRef == nil {
+			if err := r.Create(ctx, secret); err != nil {
+				return nil, err
+			}
+			return r.populateSecret(ctx, object, secret)
+		}
+		if err := r.issueToken(ctx, object, secret); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token mode %q", mode)
+	}
+
+	if err := r.Create(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// populateSecret issues a token into an existing secret that was created
+// without one, which is the case for tokens bound to their own secret
+func (r *TokenReconciler) populateSecret(ctx context.Context, object *apiv1beta1.Token, secret *v1.Secret) (*v1.Secret, error) {
+	secret = secret.DeepCopy()
+	if err := r.issueToken(ctx, object, secret); err != nil {
+		return nil, err
+	}
+
+	if err := r.Update(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// issueToken requests a bound token for the object and writes it into the
+// secret along with the outputs kept alongside the token
+func (r *TokenReconciler) issueToken(ctx context.Context, object *apiv1beta1.Token, secret *v1.Secret) error {
+	tokenRequest, err := r.requestToken(ctx, object, secret)
+	if err != nil {
+		return err
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annotationExpirationTimestamp] = tokenRequest.Status.ExpirationTimestamp.UTC().Format(time.RFC3339)
+	secret.Data = map[string][]byte{
+		v1.ServiceAccountTokenKey:     []byte(tokenRequest.Status.Token),
+		v1.ServiceAccountRootCAKey:    r.RootCA,
+		v1.ServiceAccountNamespaceKey: []byte(object.Namespace),
+	}
+	secret.Annotations[annotationChecksum] = secretChecksum(secret)
+	// outputs that fail to render are reported once the token is current
+	issued, _, err := r.outputData(object, secret)
+	if err != nil && !isOutputError(err) {
+		return err
+	}
+	setOutputKeys(secret, issued)
+
+	return nil
+}
+
+// requestToken calls the TokenRequest API for the service account of the
+// object. The token is bound to the bound object of the object if it has
+// one, or else to the secret it is stored in.
+func (r *TokenReconciler) requestToken(ctx context.Context, object *apiv1beta1.Token, secret *v1.Secret) (*authenticationv1.TokenRequest, error) {
+	reqLogger := log.FromContext(ctx)
+
+	request := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         object.Spec.Audiences,
+			ExpirationSeconds: tokenExpirationSeconds(object),
+		},
+	}
+
+	if ref := object.Spec.BoundObjectRef; ref != nil {
+		request.Spec.BoundObjectRef = &authenticationv1.BoundObjectReference{
+			Kind:       ref.Kind,
+			APIVersion: ref.APIVersion,
+			Name:       ref.Name,
+			UID:        ref.UID,
+		}
+	} else {
+		request.Spec.BoundObjectRef = &authenticationv1.BoundObjectReference{
+			Kind:       "Secret",
+			APIVersion: "v1",
+			Name:       secret.Name,
+			UID:        secret.UID,
+		}
+	}
+
+	tokenRequest, err := r.Clientset.CoreV1().ServiceAccounts(object.Namespace).CreateToken(
+		ctx,
+		object.Spec.ServiceAccountName,
+		request,
+		v12.CreateOptions{},
+	)
+	if err != nil {
+		reqLogger.Error(err, "failed to request token", "serviceAccountName", object.Spec.ServiceAccountName)
+		return nil, err
+	}
+
+	return tokenRequest, nil
+}
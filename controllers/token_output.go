@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// kubeconfigFor builds a kubeconfig from the token, CA and namespace held in
+// the secret
+func (r *TokenReconciler) kubeconfigFor(object *apiv1beta1.Token, secret *v1.Secret) ([]byte, error) {
+	kubeconfig := object.Spec.Output.Kubeconfig
+
+	server := kubeconfig.Server
+	if len(server) == 0 {
+		server = r.APIServerURL
+	}
+	// the URL the operator connects to, such as the in-cluster service
+	// address, is usually not reachable by consumers of the kubeconfig
+	if len(server) == 0 {
+		return nil, &outputError{err: fmt.Errorf("kubeconfig server is not set and no api server url is configured")}
+	}
+
+	user := object.Spec.ServiceAccountName
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[kubeconfig.ClusterName] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: secret.Data[v1.ServiceAccountRootCAKey],
+	}
+	config.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		Token: string(secret.Data[v1.ServiceAccountTokenKey]),
+	}
+	config.Contexts[kubeconfig.ContextName] = &clientcmdapi.Context{
+		Cluster:   kubeconfig.ClusterName,
+		AuthInfo:  user,
+		Namespace: string(secret.Data[v1.ServiceAccountNamespaceKey]),
+	}
+	config.CurrentContext = kubeconfig.ContextName
+
+	return clientcmd.Write(*config)
+}
+
+// outputError is returned for outputs that cannot be rendered from the
+// token, which is not resolved by retrying but by changing the object or the
+// configuration of the operator
+type outputError struct {
+	err error
+}
+
+func (e *outputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *outputError) Unwrap() error {
+	return e.err
+}
+
+// isOutputError checks if the error is an output that failed to render
+func isOutputError(err error) bool {
+	_, ok := err.(*outputError)
+	return ok
+}
+
+// renderTemplates renders the output templates of the object with the token
+// held in the secret
+func renderTemplates(object *apiv1beta1.Token, secret *v1.Secret) (map[string][]byte, error) {
+	data := apiv1beta1.TemplateData{
+		Token:              string(secret.Data[v1.ServiceAccountTokenKey]),
+		CACert:             string(secret.Data[v1.ServiceAccountRootCAKey]),
+		Namespace:          string(secret.Data[v1.ServiceAccountNamespaceKey]),
+		ServiceAccountName: object.Spec.ServiceAccountName,
+	}
+	if expiry, ok := secretExpiry(object, secret); ok {
+		data.Expiry = expiry.UTC()
+	}
+
+	rendered := make(map[string][]byte)
+	for key, text := range object.Spec.Output.Templates {
+		tmpl, err := apiv1beta1.ParseTemplate(key, text)
+		if err != nil {
+			return nil, &outputError{err: fmt.Errorf("failed to parse template %s: %w", key, err)}
+		}
+
+		output, err := apiv1beta1.ExecuteTemplate(tmpl, data)
+		if err != nil {
+			return nil, &outputError{err: fmt.Errorf("failed to render template %s: %w", key, err)}
+		}
+		rendered[key] = output
+	}
+
+	return rendered, nil
+}
+
+// outputData renders the outputs of the object from the token held in the
+// secret. Outputs written alongside the token are returned separately from
+// those written to secrets of their own, which are keyed by secret name.
+// Outputs that fail to render are left out and reported by an outputError
+// returned along with the others.
+func (r *TokenReconciler) outputData(
+	object *apiv1beta1.Token,
+	secret *v1.Secret,
+) (map[string][]byte, map[string]map[string][]byte, error) {
+	issued := make(map[string][]byte)
+	outputs := make(map[string]map[string][]byte)
+
+	var outputErr error
+	if object.Spec.Output != nil && object.Spec.Output.Kubeconfig != nil {
+		data, err := r.kubeconfigFor(object, secret)
+		if err != nil && !isOutputError(err) {
+			return nil, nil, err
+		}
+		if err != nil {
+			outputErr = err
+		} else if name := object.Spec.Output.Kubeconfig.SecretName; len(name) == 0 {
+			issued[keyKubeconfig] = data
+		} else {
+			outputs[name] = map[string][]byte{keyKubeconfig: data}
+		}
+	}
+
+	// templates are written to the target secret if there is one
+	if object.Spec.Output != nil && len(object.Spec.Output.Templates) > 0 {
+		rendered, err := renderTemplates(object, secret)
+		if err != nil {
+			if !isOutputError(err) {
+				return nil, nil, err
+			}
+			if outputErr == nil {
+				outputErr = err
+			}
+		}
+		data := issued
+		if target := object.Spec.Target; target != nil {
+			if data = outputs[target.SecretName]; data == nil {
+				data = make(map[string][]byte)
+				outputs[target.SecretName] = data
+			}
+		}
+		for key, value := range rendered {
+			data[key] = value
+		}
+	}
+
+	// the target secret mirrors the current secret along with its outputs
+	if target := object.Spec.Target; target != nil {
+		data, ok := outputs[target.SecretName]
+		if !ok {
+			data = make(map[string][]byte)
+			outputs[target.SecretName] = data
+		}
+		for _, key := range []string{
+			v1.ServiceAccountTokenKey,
+			v1.ServiceAccountRootCAKey,
+			v1.ServiceAccountNamespaceKey,
+		} {
+			data[key] = secret.Data[key]
+		}
+		for key, value := range issued {
+			data[key] = value
+		}
+	}
+
+	return issued, outputs, outputErr
+}
+
+// setOutputKeys writes the output data into the issued secret, removing keys
+// written by earlier outputs that are no longer configured
+func setOutputKeys(secret *v1.Secret, data map[string][]byte) {
+	for _, key := range strings.Split(secret.Annotations[annotationOutputKeys], ",") {
+		if _, ok := data[key]; !ok && len(key) > 0 {
+			delete(secret.Data, key)
+		}
+	}
+
+	keys := make([]string, 0, len(data))
+	for key, value := range data {
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 {
+		delete(secret.Annotations, annotationOutputKeys)
+		return
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annotationOutputKeys] = strings.Join(keys, ",")
+}
+
+// isOutputSecret checks if the secret holds outputs rather than an issued token
+func isOutputSecret(secret *v1.Secret) bool {
+	_, ok := secret.Annotations[annotationOutput]
+	return ok
+}
+
+// listOutputSecrets returns the output secrets owned by the object
+func (r *TokenReconciler) listOutputSecrets(ctx context.Context, object *apiv1beta1.Token) ([]v1.Secret, error) {
+	secrets := &v1.SecretList{}
+	if err := r.List(
+		ctx,
+		secrets,
+		client.InNamespace(object.Namespace),
+		client.MatchingFields{indexOwnerUID: string(object.UID)},
+	); err != nil {
+		return nil, err
+	}
+
+	var outputs []v1.Secret
+	for _, secret := range secrets.Items {
+		if isOutputSecret(&secret) {
+			outputs = append(outputs, secret)
+		}
+	}
+
+	return outputs, nil
+}
+
+// reconcileOutputs writes the outputs of the current token, either into the
+// current secret or into output secrets, and deletes output secrets that are
+// no longer configured. The updated current secret is returned, along with
+// an outputError for outputs that failed to render, in which case output
+// secrets are not deleted.
+func (r *TokenReconciler) reconcileOutputs(ctx context.Context, object *apiv1beta1.Token, current *v1.Secret) (*v1.Secret, error) {
+	reqLogger := log.FromContext(ctx)
+
+	issued, outputs, outputErr := r.outputData(object, current)
+	if outputErr != nil && !isOutputError(outputErr) {
+		return nil, outputErr
+	}
+
+	updated := current.DeepCopy()
+	setOutputKeys(updated, issued)
+	if !equality.Semantic.DeepEqual(current, updated) {
+		if err := r.Update(ctx, updated); err != nil {
+			reqLogger.Error(err, "failed to update secret", "name", current.Name)
+			return nil, err
+		}
+		reqLogger.Info("updated secret outputs", "name", current.Name)
+		current = updated
+	}
+
+	for name, data := range outputs {
+		if err := r.writeOutputSecret(ctx, object, name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if outputErr != nil {
+		return current, outputErr
+	}
+
+	secrets, err := r.listOutputSecrets(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list output secrets")
+		return nil, err
+	}
+
+	var stale []v1.Secret
+	for _, secret := range secrets {
+		if _, ok := outputs[secret.Name]; !ok {
+			stale = append(stale, secret)
+		}
+	}
+	if err := r.deleteSecrets(ctx, stale); err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// outputSecretType returns the type of the output secret with the given
+// name, which is the output type for the target secret and Opaque otherwise
+func outputSecretType(object *apiv1beta1.Token, name string) v1.SecretType {
+	if target := object.Spec.Target; target != nil && target.SecretName == name &&
+		object.Spec.Output != nil && len(object.Spec.Output.Type) > 0 {
+		return object.Spec.Output.Type
+	}
+	return v1.SecretTypeOpaque
+}
+
+// writeOutputSecret creates or updates an output secret with the given data.
+// Existing secrets not controlled by the object are left alone, while those of
+// another type are recreated, since the type of a secret cannot be changed.
+func (r *TokenReconciler) writeOutputSecret(ctx context.Context, object *apiv1beta1.Token, name string, data map[string][]byte) error {
+	reqLogger := log.FromContext(ctx)
+
+	secret, err := r.getSecret(ctx, object.Namespace, name)
+	if err != nil {
+		reqLogger.Error(err, "failed to get output secret", "name", name)
+		return err
+	}
+
+	secretType := outputSecretType(object, name)
+	if secret != nil && secret.Type != secretType && v12.IsControlledBy(secret, object) {
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			reqLogger.Error(err, "failed to delete output secret", "name", name)
+			return err
+		}
+		reqLogger.Info("deleted output secret of another type", "name", name, "type", secret.Type)
+		secret = nil
+	}
+
+	if secret == nil {
+		secret = &v1.Secret{
+			ObjectMeta: v12.ObjectMeta{
+				Name:      name,
+				Namespace: object.Namespace,
+				Labels: map[string]string{
+					labelManagedBy: managedBy,
+				},
+				Annotations: map[string]string{
+					annotationOutput: object.Name,
+				},
+			},
+			Type: secretType,
+			Data: data,
+		}
+		if err := controllerutil.SetControllerReference(object, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			if errors.IsAlreadyExists(err) {
+				// picked up on the next reconcile once the cache has caught up
+				return nil
+			}
+			reqLogger.Error(err, "failed to create output secret", "name", name)
+			return err
+		}
+		reqLogger.Info("created output secret", "name", name)
+		return nil
+	}
+
+	if !v12.IsControlledBy(secret, object) {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretNameConflict,
+			"secret %s already exists and is not controlled by the token, not writing outputs",
+			name,
+		)
+		return nil
+	}
+
+	updated := secret.DeepCopy()
+	updated.Data = data
+	if updated.Labels == nil {
+		updated.Labels = make(map[string]string)
+	}
+	updated.Labels[labelManagedBy] = managedBy
+	if updated.Annotations == nil {
+		updated.Annotations = make(map[string]string)
+	}
+	updated.Annotations[annotationOutput] = object.Name
+	if equality.Semantic.DeepEqual(secret, updated) {
+		return nil
+	}
+
+	if err := r.Update(ctx, updated); err != nil {
+		reqLogger.Error(err, "failed to update output secret", "name", name)
+		return err
+	}
+	reqLogger.Info("updated output secret", "name", name)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// patcher is implemented by both the client and its status writer
+type patcher interface {
+	Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error
+}
+
+// patchObject applies mutate to the object and writes the change as a merge
+// patch under the operator field owner. The patch carries the resource version
+// of the object, and conflicts are retried against the latest version read
+// from the API server. On success the object reflects the written state.
+func (r *TokenReconciler) patchObject(
+	ctx context.Context,
+	writer patcher,
+	object *apiv1beta1.Token,
+	mutate func(*apiv1beta1.Token),
+) error {
+	latest := object.DeepCopy()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		updated := latest.DeepCopy()
+		mutate(updated)
+		if equality.Semantic.DeepEqual(latest, updated) {
+			updated.DeepCopyInto(object)
+			return nil
+		}
+
+		err := writer.Patch(
+			ctx,
+			updated,
+			client.MergeFromWithOptions(latest, client.MergeFromWithOptimisticLock{}),
+			client.FieldOwner(fieldOwner),
+		)
+		if err == nil {
+			updated.DeepCopyInto(object)
+			return nil
+		}
+
+		if apimachineryerrors.IsConflict(err) {
+			latest = &apiv1beta1.Token{}
+			if err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(object), latest); err != nil {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+// patchStatus writes the status of the object through the status subresource.
+// The status is computed from the version of the object read by this
+// reconcile, so the patch carries that resource version and a conflict is
+// returned rather than retried, which would overwrite the status written by
+// another reconcile. The object is requeued on conflicts by requeueOnConflict.
+func (r *TokenReconciler) patchStatus(ctx context.Context, object *apiv1beta1.Token, status *apiv1beta1.TokenStatus) error {
+	if equality.Semantic.DeepEqual(&object.Status, status) {
+		return nil
+	}
+
+	updated := object.DeepCopy()
+	status.DeepCopyInto(&updated.Status)
+	if err := r.Status().Patch(
+		ctx,
+		updated,
+		client.MergeFromWithOptions(object, client.MergeFromWithOptimisticLock{}),
+		client.FieldOwner(fieldOwner),
+	); err != nil {
+		return err
+	}
+
+	updated.DeepCopyInto(object)
+	return nil
+}
+
+// requeueOnConflict turns a conflict into a requeue of the object, so that
+// the next reconcile starts from the latest version of the object
+func requeueOnConflict(ctx context.Context, result ctrl.Result, err error) (ctrl.Result, error) {
+	if apimachineryerrors.IsConflict(err) {
+		log.FromContext(ctx).Info("object was modified, requeueing")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return result, err
+}
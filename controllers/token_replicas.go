@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// replicaOf identifies the token a replica was copied from. Replicas live in
+// other namespaces and cannot carry an owner reference to the token.
+func replicaOf(object *apiv1beta1.Token) string {
+	return object.Namespace + "/" + object.Name
+}
+
+// replicaNamespaces returns the namespaces the current token is copied to,
+// excluding the namespace of the object itself
+func (r *TokenReconciler) replicaNamespaces(ctx context.Context, object *apiv1beta1.Token) ([]string, error) {
+	replicateTo := object.Spec.ReplicateTo
+	if replicateTo == nil {
+		return nil, nil
+	}
+
+	selected := make(map[string]struct{})
+	for _, namespace := range replicateTo.Namespaces {
+		selected[namespace] = struct{}{}
+	}
+
+	if replicateTo.NamespaceSelector != nil {
+		selector, err := v12.LabelSelectorAsSelector(replicateTo.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		namespaces := &v1.NamespaceList{}
+		if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces.Items {
+			selected[namespace.Name] = struct{}{}
+		}
+	}
+	delete(selected, object.Namespace)
+
+	namespaces := make([]string, 0, len(selected))
+	for namespace := range selected {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, nil
+}
+
+// listReplicas returns the copies of the token in other namespaces
+func (r *TokenReconciler) listReplicas(ctx context.Context, object *apiv1beta1.Token) ([]v1.Secret, error) {
+	secrets := &v1.SecretList{}
+	if err := r.List(ctx, secrets, client.MatchingFields{indexReplicaOf: replicaOf(object)}); err != nil {
+		return nil, err
+	}
+	return secrets.Items, nil
+}
+
+// reconcileReplicas copies the data of the current secret into the selected
+// namespaces and deletes copies in namespaces that are no longer selected.
+// The copies that were written are returned for the status.
+func (r *TokenReconciler) reconcileReplicas(ctx context.Context, object *apiv1beta1.Token, current *v1.Secret) ([]apiv1beta1.ReplicaStatus, error) {
+	reqLogger := log.FromContext(ctx)
+
+	namespaces, err := r.replicaNamespaces(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to select replica namespaces")
+		return nil, err
+	}
+
+	var replicas []apiv1beta1.ReplicaStatus
+	desired := make(map[types.NamespacedName]struct{})
+	for _, namespace := range namespaces {
+		key := types.NamespacedName{Namespace: namespace, Name: object.Spec.ReplicateTo.SecretName}
+		desired[key] = struct{}{}
+
+		written, err := r.writeReplica(ctx, object, key, current.Data)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			replicas = append(replicas, apiv1beta1.ReplicaStatus{Namespace: key.Namespace, Name: key.Name})
+		}
+	}
+
+	secrets, err := r.listReplicas(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list replicas")
+		return nil, err
+	}
+
+	var stale []v1.Secret
+	for _, secret := range secrets {
+		if _, ok := desired[client.ObjectKeyFromObject(&secret)]; !ok {
+			stale = append(stale, secret)
+		}
+	}
+	if err := r.deleteSecrets(ctx, stale); err != nil {
+		return nil, err
+	}
+
+	return replicas, nil
+}
+
+// writeReplica creates or updates a copy of the token with the given data.
+// Existing secrets that are not copies of the token are left alone, in which
+// case false is returned.
+func (r *TokenReconciler) writeReplica(ctx context.Context, object *apiv1beta1.Token, key types.NamespacedName, data map[string][]byte) (bool, error) {
+	reqLogger := log.FromContext(ctx)
+
+	secret, err := r.getSecret(ctx, key.Namespace, key.Name)
+	if err != nil {
+		reqLogger.Error(err, "failed to get replica", "namespace", key.Namespace, "name", key.Name)
+		return false, err
+	}
+
+	if secret == nil {
+		secret = &v1.Secret{
+			ObjectMeta: v12.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels: map[string]string{
+					labelManagedBy: managedBy,
+				},
+				Annotations: map[string]string{
+					annotationReplicaOf: replicaOf(object),
+				},
+			},
+			Type: v1.SecretTypeOpaque,
+			Data: data,
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			if errors.IsNotFound(err) || errors.IsForbidden(err) {
+				// namespaces that are being deleted cannot hold new secrets
+				reqLogger.Info("skipped replica", "namespace", key.Namespace, "reason", err.Error())
+				return false, nil
+			}
+			reqLogger.Error(err, "failed to create replica", "namespace", key.Namespace, "name", key.Name)
+			return false, err
+		}
+		reqLogger.Info("created replica", "namespace", key.Namespace, "name", key.Name)
+		return true, nil
+	}
+
+	if secret.Annotations[annotationReplicaOf] != replicaOf(object) {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretNameConflict,
+			"secret %s/%s already exists and is not a copy of the token, not replicating",
+			key.Namespace,
+			key.Name,
+		)
+		return false, nil
+	}
+
+	updated := secret.DeepCopy()
+	updated.Data = data
+	if updated.Labels == nil {
+		updated.Labels = make(map[string]string)
+	}
+	updated.Labels[labelManagedBy] = managedBy
+	if equality.Semantic.DeepEqual(secret, updated) {
+		return true, nil
+	}
+
+	if err := r.Update(ctx, updated); err != nil {
+		reqLogger.Error(err, "failed to update replica", "namespace", key.Namespace, "name", key.Name)
+		return false, err
+	}
+	reqLogger.Info("updated replica", "namespace", key.Namespace, "name", key.Name)
+
+	return true, nil
+}
+
+// secretReplicaOf returns the token the secret is a copy of
+func secretReplicaOf(object client.Object) []string {
+	if value, ok := object.GetAnnotations()[annotationReplicaOf]; ok {
+		return []string{value}
+	}
+	return nil
+}
+
+// tokenForReplica maps a copy of a token to a reconcile request for the
+// token, so that copies modified or deleted outside the operator are restored
+func (r *TokenReconciler) tokenForReplica(object client.Object) []reconcile.Request {
+	value, ok := object.GetAnnotations()[annotationReplicaOf]
+	if !ok {
+		return nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Namespace: parts[0],
+				Name:      parts[1],
+			},
+		},
+	}
+}
+
+// tokensForNamespace maps a namespace to reconcile requests for the tokens
+// replicating into namespaces, so that copies follow namespaces as they are
+// created and relabeled
+func (r *TokenReconciler) tokensForNamespace(object client.Object) []reconcile.Request {
+	tokens := &apiv1beta1.TokenList{}
+	if err := r.List(context.Background(), tokens); err != nil {
+		ctrl.Log.WithName("tokens-for-namespace").Error(err, "failed to list tokens", "namespace", object.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, token := range tokens.Items {
+		if token.Spec.ReplicateTo == nil || token.Namespace == object.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: token.Namespace,
+				Name:      token.Name,
+			},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// requestTime returns the time held by a request annotation of the object.
+// Times are truncated to seconds, the precision they are recorded at in the
+// status.
+func requestTime(object *apiv1beta1.Token, annotation string) (time.Time, bool) {
+	value, ok := object.Annotations[annotation]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	requestedAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return requestedAt.Truncate(time.Second), true
+}
+
+// requestDue returns the time held by a request annotation of the object if
+// that time has passed and the request was not handled yet
+func requestDue(object *apiv1beta1.Token, annotation string, observed *v12.Time) (time.Time, bool) {
+	requestedAt, ok := requestTime(object, annotation)
+	if !ok || requestedAt.After(time.Now()) {
+		return time.Time{}, false
+	}
+
+	if observed != nil && observed.Time.Equal(requestedAt) {
+		return time.Time{}, false
+	}
+	return requestedAt, true
+}
+
+// revokeSecrets deletes the secrets issued up to the time of the revocation
+// without waiting for the grace period, and returns the deleted secrets
+func (r *TokenReconciler) revokeSecrets(ctx context.Context, secrets []v1.Secret, revokeAt time.Time) ([]v1.Secret, error) {
+	var revoked []v1.Secret
+	for _, secret := range secrets {
+		if !secret.CreationTimestamp.Time.After(revokeAt) {
+			revoked = append(revoked, secret)
+		}
+	}
+
+	if err := r.deleteSecrets(ctx, revoked); err != nil {
+		return nil, err
+	}
+
+	return revoked, nil
+}
+
+// revokeCopies deletes the output secrets and the replicas of the object,
+// which hold copies of the revoked tokens. They are written again once a new
+// token is issued.
+func (r *TokenReconciler) revokeCopies(ctx context.Context, object *apiv1beta1.Token) error {
+	reqLogger := log.FromContext(ctx)
+
+	outputs, err := r.listOutputSecrets(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list output secrets")
+		return err
+	}
+	if err := r.deleteSecrets(ctx, outputs); err != nil {
+		return err
+	}
+
+	replicas, err := r.listReplicas(ctx, object)
+	if err != nil {
+		reqLogger.Error(err, "failed to list replicas")
+		return err
+	}
+	return r.deleteSecrets(ctx, replicas)
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	"github.com/kubetrail/serviceaccount-operator/internal/cron"
+	v1 "k8s.io/api/core/v1"
+)
+
+// rotationLocation returns the time zone the rotation schedule and the
+// maintenance windows of the object are evaluated in
+func rotationLocation(rotation *apiv1beta1.RotationSpec) *time.Location {
+	if rotation == nil || len(rotation.TimeZone) == 0 {
+		return time.UTC
+	}
+
+	location, err := time.LoadLocation(rotation.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// rotationScheduleError returns the error of a rotation schedule or
+// maintenance window that fails to parse, in which case tokens are not
+// rotated on that schedule
+func rotationScheduleError(object *apiv1beta1.Token) error {
+	rotation := object.Spec.Rotation
+	if rotation == nil {
+		return nil
+	}
+
+	if len(rotation.Schedule) > 0 {
+		if _, err := cron.Parse(rotation.Schedule); err != nil {
+			return fmt.Errorf("rotation schedule %q is invalid: %w", rotation.Schedule, err)
+		}
+	}
+
+	for _, window := range rotation.MaintenanceWindows {
+		if _, err := cron.Parse(window.Schedule); err != nil {
+			return fmt.Errorf("maintenance window schedule %q is invalid: %w", window.Schedule, err)
+		}
+	}
+
+	return nil
+}
+
+// rotationTimeFrom returns the time a token issued at the given time is due
+// for rotation. The rotation is due at the next activation of the schedule,
+// or else once the rotation period has passed, moved earlier by the jitter of
+// the object and then into the next maintenance window unless that exceeds
+// the max token age. The zero time is returned if the object does not rotate
+// its tokens.
+func rotationTimeFrom(object *apiv1beta1.Token, issuedAt time.Time) time.Time {
+	rotation := object.Spec.Rotation
+	location := rotationLocation(rotation)
+
+	var rotateAt time.Time
+	switch {
+	case rotation != nil && len(rotation.Schedule) > 0:
+		if schedule, err := cron.Parse(rotation.Schedule); err == nil {
+			rotateAt = schedule.Next(issuedAt.In(location))
+		}
+	case object.Spec.RotationPeriodSeconds != nil:
+		rotateAt = issuedAt.Add(time.Second * time.Duration(*object.Spec.RotationPeriodSeconds))
+	}
+
+	if rotation == nil {
+		return rotateAt
+	}
+
+	if !rotateAt.IsZero() && rotation.JitterPercent > 0 {
+		rotateAt = rotateAt.Add(-rotationJitter(object, rotateAt.Sub(issuedAt), rotation.JitterPercent))
+	}
+
+	if !rotateAt.IsZero() && len(rotation.MaintenanceWindows) > 0 {
+		rotateAt = nextMaintenanceWindow(rotation.MaintenanceWindows, rotateAt.In(location))
+	}
+
+	if rotation.MaxTokenAgeSeconds != nil {
+		expireAt := issuedAt.Add(time.Second * time.Duration(*rotation.MaxTokenAgeSeconds))
+		if rotateAt.IsZero() || rotateAt.After(expireAt) {
+			rotateAt = expireAt
+		}
+	}
+
+	return rotateAt
+}
+
+// overdueRotationTime returns the earliest time from now on at which an
+// overdue rotation of the secret may run. Rotations only run inside
+// maintenance windows, unless the secret has exceeded the max token age or
+// its bound token is about to expire.
+func overdueRotationTime(object *apiv1beta1.Token, secret *v1.Secret, now time.Time) time.Time {
+	rotation := object.Spec.Rotation
+	if rotation == nil {
+		return now
+	}
+
+	rotateAt := now
+	if len(rotation.MaintenanceWindows) > 0 {
+		rotateAt = nextMaintenanceWindow(rotation.MaintenanceWindows, now.In(rotationLocation(rotation)))
+	}
+
+	if rotation.MaxTokenAgeSeconds != nil {
+		expireAt := secret.CreationTimestamp.Time.Add(time.Second * time.Duration(*rotation.MaxTokenAgeSeconds))
+		if rotateAt.IsZero() || rotateAt.After(expireAt) {
+			rotateAt = expireAt
+		}
+	}
+
+	if deadline, ok := expiryRotationTime(secret); ok && (rotateAt.IsZero() || rotateAt.After(deadline)) {
+		rotateAt = deadline
+	}
+
+	return rotateAt
+}
+
+// rotationJitter returns the offset the rotation of the object is moved
+// earlier by, which is a fraction of the given percentage of the rotation
+// interval derived from the UID of the object
+func rotationJitter(object *apiv1beta1.Token, interval time.Duration, percent int32) time.Duration {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(object.UID))
+	fraction := float64(hash.Sum64()) / float64(math.MaxUint64)
+
+	return time.Duration(float64(interval) * float64(percent) / 100 * fraction)
+}
+
+// nextMaintenanceWindow returns t if it falls inside one of the windows, or
+// else the earliest start of a window after t. The zero time is returned if
+// none of the windows open again.
+func nextMaintenanceWindow(windows []apiv1beta1.MaintenanceWindow, t time.Time) time.Time {
+	var next time.Time
+	for _, window := range windows {
+		schedule, err := cron.Parse(window.Schedule)
+		if err != nil {
+			continue
+		}
+
+		// the first start after t-duration is either a window t falls
+		// inside of or the next window to open
+		start := schedule.Next(t.Add(-time.Second * time.Duration(window.DurationSeconds)))
+		if start.IsZero() {
+			continue
+		}
+		if !start.After(t) {
+			return t
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
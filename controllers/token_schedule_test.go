@@ -0,0 +1,193 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNextMaintenanceWindow(t *testing.T) {
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2022, 3, day, hour, min, 0, 0, time.UTC)
+	}
+	nightly := apiv1beta1.MaintenanceWindow{Schedule: "0 2 * * *", DurationSeconds: 3600}
+	weekly := apiv1beta1.MaintenanceWindow{Schedule: "0 10 * * 0", DurationSeconds: 4 * 3600}
+
+	tests := []struct {
+		name    string
+		windows []apiv1beta1.MaintenanceWindow
+		now     time.Time
+		want    time.Time
+	}{
+		{
+			name:    "before the window",
+			windows: []apiv1beta1.MaintenanceWindow{nightly},
+			now:     date(1, 1, 0),
+			want:    date(1, 2, 0),
+		},
+		{
+			name:    "inside the window",
+			windows: []apiv1beta1.MaintenanceWindow{nightly},
+			now:     date(1, 2, 30),
+			want:    date(1, 2, 30),
+		},
+		{
+			name:    "at the end of the window",
+			windows: []apiv1beta1.MaintenanceWindow{nightly},
+			now:     date(1, 3, 0),
+			want:    date(2, 2, 0),
+		},
+		{
+			name:    "earliest of several windows",
+			windows: []apiv1beta1.MaintenanceWindow{weekly, nightly},
+			now:     date(5, 12, 0),
+			want:    date(6, 2, 0),
+		},
+		{
+			name:    "inside the later of several windows",
+			windows: []apiv1beta1.MaintenanceWindow{nightly, weekly},
+			now:     date(6, 13, 0),
+			want:    date(6, 13, 0),
+		},
+		{
+			name:    "invalid windows are skipped",
+			windows: []apiv1beta1.MaintenanceWindow{{Schedule: "invalid", DurationSeconds: 3600}, nightly},
+			now:     date(1, 1, 0),
+			want:    date(1, 2, 0),
+		},
+		{
+			name:    "no valid windows",
+			windows: []apiv1beta1.MaintenanceWindow{{Schedule: "invalid", DurationSeconds: 3600}},
+			now:     date(1, 1, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextMaintenanceWindow(tt.windows, tt.now); !got.Equal(tt.want) {
+				t.Errorf("nextMaintenanceWindow() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotationTimeFrom(t *testing.T) {
+	seconds := func(value int64) *int64 {
+		return &value
+	}
+	token := func(periodSeconds *int64, rotation *apiv1beta1.RotationSpec) *apiv1beta1.Token {
+		return &apiv1beta1.Token{
+			ObjectMeta: v12.ObjectMeta{UID: "5c7b7a4e-8f2a-4a1e-9d3c-1f0e2b3c4d5e"},
+			Spec: apiv1beta1.TokenSpec{
+				RotationPeriodSeconds: periodSeconds,
+				Rotation:              rotation,
+			},
+		}
+	}
+
+	// issued on a Tuesday, with a daily rotation moved earlier by a jitter
+	// of between one and two hours
+	issuedAt := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := seconds(24 * 3600)
+	jitter := rotationJitter(token(day, nil), 24*time.Hour, 10)
+	if jitter < time.Hour || jitter > 2*time.Hour {
+		t.Fatalf("jitter = %s, want between 1h and 2h", jitter)
+	}
+	jittered := issuedAt.Add(24*time.Hour - jitter)
+
+	// the jittered rotation falls inside this window, while the rotation
+	// without jitter does not
+	morning := apiv1beta1.MaintenanceWindow{Schedule: "0 10 * * *", DurationSeconds: 3600}
+	sunday := apiv1beta1.MaintenanceWindow{Schedule: "0 10 * * 0", DurationSeconds: 3600}
+
+	tests := []struct {
+		name   string
+		object *apiv1beta1.Token
+		want   time.Time
+	}{
+		{
+			name:   "no rotation",
+			object: token(nil, nil),
+		},
+		{
+			name:   "rotation period",
+			object: token(day, nil),
+			want:   issuedAt.Add(24 * time.Hour),
+		},
+		{
+			name:   "rotation schedule in a time zone",
+			object: token(day, &apiv1beta1.RotationSpec{Schedule: "0 3 * * *", TimeZone: "Europe/Berlin"}),
+			want:   time.Date(2022, 3, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "jitter",
+			object: token(day, &apiv1beta1.RotationSpec{JitterPercent: 10}),
+			want:   jittered,
+		},
+		{
+			name: "jitter before the maintenance window",
+			object: token(day, &apiv1beta1.RotationSpec{
+				JitterPercent:      10,
+				MaintenanceWindows: []apiv1beta1.MaintenanceWindow{morning},
+			}),
+			want: jittered,
+		},
+		{
+			name: "maintenance window after the jitter",
+			object: token(day, &apiv1beta1.RotationSpec{
+				JitterPercent:      10,
+				MaintenanceWindows: []apiv1beta1.MaintenanceWindow{sunday},
+			}),
+			want: time.Date(2022, 3, 6, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "max token age after the maintenance window",
+			object: token(day, &apiv1beta1.RotationSpec{
+				JitterPercent:      10,
+				MaintenanceWindows: []apiv1beta1.MaintenanceWindow{sunday},
+				MaxTokenAgeSeconds: seconds(7 * 24 * 3600),
+			}),
+			want: time.Date(2022, 3, 6, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "max token age before the maintenance window",
+			object: token(day, &apiv1beta1.RotationSpec{
+				JitterPercent:      10,
+				MaintenanceWindows: []apiv1beta1.MaintenanceWindow{sunday},
+				MaxTokenAgeSeconds: seconds(36 * 3600),
+			}),
+			want: issuedAt.Add(36 * time.Hour),
+		},
+		{
+			name:   "max token age without a rotation period",
+			object: token(nil, &apiv1beta1.RotationSpec{MaxTokenAgeSeconds: seconds(36 * 3600)}),
+			want:   issuedAt.Add(36 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rotationTimeFrom(tt.object, issuedAt); !got.Equal(tt.want) {
+				t.Errorf("rotationTimeFrom() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
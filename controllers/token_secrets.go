@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// getSecret fetches a secret by name, returning nil if the name is empty
+// or the secret does not exist. Secrets missing from the cache are looked up
+// through the API server, since a secret created in a previous reconcile may
+// not have reached the cache yet.
+func (r *TokenReconciler) getSecret(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	secret := &v1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if err := r.APIReader.Get(ctx, key, secret); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	if secret.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	return secret, nil
+}
+
+// secretPopulated checks if the secret holds all keys consumers expect
+// from a service account token secret
+func secretPopulated(secret *v1.Secret) bool {
+	for _, key := range []string{
+		v1.ServiceAccountTokenKey,
+		v1.ServiceAccountRootCAKey,
+		v1.ServiceAccountNamespaceKey,
+	} {
+		if len(secret.Data[key]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rotationTime returns the time the secret is due for rotation, which is
+// zero if the object does not rotate its tokens. A bound token is rotated
+// ahead of the expiration the API server returned for it, which may be
+// earlier than requested.
+func rotationTime(object *apiv1beta1.Token, secret *v1.Secret) time.Time {
+	rotateAt := rotationTimeFrom(object, secret.CreationTimestamp.Time)
+	if deadline, ok := expiryRotationTime(secret); ok && (rotateAt.IsZero() || deadline.Before(rotateAt)) {
+		rotateAt = deadline
+	}
+	return rotateAt
+}
+
+// expiryRotationTime returns the latest time a bound token in the secret is
+// rotated at, which is the expiring soon threshold before its expiration but
+// no more than a fifth of its lifetime
+func expiryRotationTime(secret *v1.Secret) (time.Time, bool) {
+	value, ok := secret.Annotations[annotationExpirationTimestamp]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	margin := expiringSoonThreshold
+	if lifetime := expiry.Sub(secret.CreationTimestamp.Time); lifetime/5 < margin {
+		margin = lifetime / 5
+	}
+	return expiry.Add(-margin), true
+}
+
+// rotationDue checks if the secret is due for rotation. A rotation that is
+// reconciled outside a maintenance window, for example after the operator was
+// down or the token was suspended, waits for the next window.
+func rotationDue(object *apiv1beta1.Token, secret *v1.Secret) bool {
+	now := time.Now()
+	rotateAt := rotationTime(object, secret)
+	if rotateAt.IsZero() || !now.After(rotateAt) {
+		return false
+	}
+
+	runAt := overdueRotationTime(object, secret, now)
+	return !runAt.IsZero() && !runAt.After(now)
+}
+
+// nextRotationTime returns the time the secret is rotated, which is the time
+// it is due for rotation or, for an overdue rotation waiting for a maintenance
+// window, the time the window opens
+func nextRotationTime(object *apiv1beta1.Token, secret *v1.Secret) time.Time {
+	now := time.Now()
+	rotateAt := rotationTime(object, secret)
+	if rotateAt.IsZero() || rotateAt.After(now) {
+		return rotateAt
+	}
+
+	if runAt := overdueRotationTime(object, secret, now); runAt.After(now) {
+		return runAt
+	}
+	return rotateAt
+}
+
+// secretDeleteAt returns the time the secret is deleted, which is once the
+// grace period following its rotation has passed
+func secretDeleteAt(object *apiv1beta1.Token, secret *v1.Secret) (time.Time, bool) {
+	rotateAt := rotationTime(object, secret)
+	if rotateAt.IsZero() || object.Spec.DeletionGracePeriodSeconds == nil {
+		return time.Time{}, false
+	}
+
+	return rotateAt.Add(time.Second * time.Duration(*object.Spec.DeletionGracePeriodSeconds)), true
+}
+
+// secretExpiry returns the time the token in the secret stops being usable.
+// Bound tokens carry their expiration timestamp, while legacy tokens are
+// usable until the secret is deleted after its rotation and grace period.
+func secretExpiry(object *apiv1beta1.Token, secret *v1.Secret) (time.Time, bool) {
+	if secret == nil {
+		return time.Time{}, false
+	}
+
+	if value, ok := secret.Annotations[annotationExpirationTimestamp]; ok {
+		if expiry, err := time.Parse(time.RFC3339, value); err == nil {
+			return expiry, true
+		}
+	}
+
+	rotateAt := rotationTime(object, secret)
+	if rotateAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	if object.Spec.DeletionGracePeriodSeconds != nil {
+		rotateAt = rotateAt.Add(time.Second * time.Duration(*object.Spec.DeletionGracePeriodSeconds))
+	}
+
+	return rotateAt, true
+}
+
+// expiringSoon checks if the token in the secret stops being usable within
+// the expiring soon threshold
+func expiringSoon(object *apiv1beta1.Token, secret *v1.Secret) bool {
+	expiry, ok := secretExpiry(object, secret)
+	return ok && time.Until(expiry) < expiringSoonThreshold
+}
+
+// secretNameFor derives the name of the n-th secret issued for the object.
+// Names are deterministic so that a secret whose creation was interrupted
+// is found again, and unique across tokens that reuse a name.
+func secretNameFor(object *apiv1beta1.Token, n int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", object.UID, n)))
+	return fmt.Sprintf("%s-token-%s", object.Name, hex.EncodeToString(sum[:])[:10])
+}
+
+// adoptSecret returns an existing secret with the recorded name if it is
+// controlled by the object. A secret controlled by anything else is left
+// alone and nil is returned, so that the next issuance uses a new name.
+func (r *TokenReconciler) adoptSecret(ctx context.Context, object *apiv1beta1.Token, name string) (*v1.Secret, error) {
+	reqLogger := log.FromContext(ctx)
+
+	secret := &v1.Secret{}
+	if err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: object.Namespace, Name: name}, secret); err != nil {
+		return nil, err
+	}
+
+	if !v12.IsControlledBy(secret, object) {
+		r.Recorder.Eventf(
+			object,
+			v1.EventTypeWarning,
+			reasonSecretNameConflict,
+			"secret %s already exists and is not controlled by the token, issuing under a new name",
+			name,
+		)
+		return nil, nil
+	}
+
+	reqLogger.Info("adopted secret", "name", name)
+	return secret, nil
+}
+
+// recordedSecretNames returns the names of all secrets tracked in the status
+func recordedSecretNames(status *apiv1beta1.TokenStatus) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, name := range []string{status.SecretName, status.PendingSecretName} {
+		if len(name) > 0 {
+			names[name] = struct{}{}
+		}
+	}
+	for _, secretStatus := range status.Secrets {
+		names[secretStatus.Name] = struct{}{}
+	}
+	return names
+}
+
+// unrecordedSecrets returns the owned secrets that are not tracked in the
+// status. Since the cached object may lag behind the secrets, candidates are
+// checked against the latest status read from the API server.
+func (r *TokenReconciler) unrecordedSecrets(ctx context.Context, object *apiv1beta1.Token, secrets []v1.Secret) ([]v1.Secret, error) {
+	var candidates []v1.Secret
+	recorded := recordedSecretNames(&object.Status)
+	for _, secret := range secrets {
+		if _, ok := recorded[secret.Name]; !ok {
+			candidates = append(candidates, secret)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	latest := &apiv1beta1.Token{}
+	if err := r.APIReader.Get(ctx, client.ObjectKeyFromObject(object), latest); err != nil {
+		return nil, err
+	}
+
+	var unrecorded []v1.Secret
+	recorded = recordedSecretNames(&latest.Status)
+	for _, secret := range candidates {
+		if _, ok := recorded[secret.Name]; !ok {
+			unrecorded = append(unrecorded, secret)
+		}
+	}
+
+	return unrecorded, nil
+}
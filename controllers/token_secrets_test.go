@@ -0,0 +1,195 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+)
+
+// newTestReconciler returns a reconciler reading through the cache of the
+// test manager, with events discarded
+func newTestReconciler() *TokenReconciler {
+	return &TokenReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              scheme.Scheme,
+		APIReader:           mgr.GetAPIReader(),
+		Recorder:            &record.FakeRecorder{},
+		ProvisioningTimeout: time.Minute,
+	}
+}
+
+// createTestToken creates a token issuing legacy secrets for a new service
+// account, which are created but never populated in the test environment
+func createTestToken(ctx context.Context, name string) *apiv1beta1.Token {
+	serviceAccount := &v1.ServiceAccount{
+		ObjectMeta: v12.ObjectMeta{Name: name, Namespace: "default"},
+	}
+	Expect(k8sClient.Create(ctx, serviceAccount)).To(Succeed())
+
+	object := &apiv1beta1.Token{
+		ObjectMeta: v12.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: apiv1beta1.TokenSpec{
+			ServiceAccountName: name,
+			Mode:               apiv1beta1.TokenModeLegacySecret,
+		},
+	}
+	Expect(k8sClient.Create(ctx, object)).To(Succeed())
+	return object
+}
+
+// createTestSecret creates a secret, controlled by the object if one is given
+func createTestSecret(ctx context.Context, object *apiv1beta1.Token, name string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: v12.ObjectMeta{Name: name, Namespace: "default"},
+		Type:       v1.SecretTypeOpaque,
+	}
+	if object != nil {
+		Expect(controllerutil.SetControllerReference(object, secret, scheme.Scheme)).To(Succeed())
+	}
+	Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+	return secret
+}
+
+// cachedVersion returns a function reading the resource version of the
+// object from the cache of the test manager, for waiting until the cache has
+// caught up
+func cachedVersion(object client.Object) func() (string, error) {
+	return func() (string, error) {
+		latest := object.DeepCopyObject().(client.Object)
+		err := mgr.GetClient().Get(ctx, client.ObjectKeyFromObject(object), latest)
+		return latest.GetResourceVersion(), err
+	}
+}
+
+var _ = Describe("Token secret recovery", func() {
+	It("derives deterministic names unique to the token and issuance", func() {
+		object := &apiv1beta1.Token{ObjectMeta: v12.ObjectMeta{Name: "sample", UID: "uid-1"}}
+		other := &apiv1beta1.Token{ObjectMeta: v12.ObjectMeta{Name: "sample", UID: "uid-2"}}
+
+		name := secretNameFor(object, 1)
+		Expect(strings.HasPrefix(name, "sample-token-")).To(BeTrue())
+		Expect(secretNameFor(object, 1)).To(Equal(name))
+		Expect(secretNameFor(object, 2)).NotTo(Equal(name))
+		Expect(secretNameFor(other, 1)).NotTo(Equal(name))
+	})
+
+	It("adopts only secrets controlled by the token", func() {
+		r := newTestReconciler()
+		object := createTestToken(ctx, "adopt")
+
+		owned := createTestSecret(ctx, object, "adopt-owned")
+		adopted, err := r.adoptSecret(ctx, object, owned.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adopted).NotTo(BeNil())
+		Expect(adopted.UID).To(Equal(owned.UID))
+
+		foreign := createTestSecret(ctx, nil, "adopt-foreign")
+		adopted, err = r.adoptSecret(ctx, object, foreign.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(adopted).To(BeNil())
+	})
+
+	It("finds unrecorded secrets against the latest status", func() {
+		r := newTestReconciler()
+		object := createTestToken(ctx, "unrecorded")
+		stale := object.DeepCopy()
+
+		recorded := createTestSecret(ctx, object, "unrecorded-recorded")
+		pending := createTestSecret(ctx, object, "unrecorded-pending")
+		leftover := createTestSecret(ctx, object, "unrecorded-leftover")
+
+		// the status was written after the stale copy was read
+		status := object.Status.DeepCopy()
+		status.Phase = phaseReady
+		status.SecretName = recorded.Name
+		status.PendingSecretName = pending.Name
+		Expect(r.patchStatus(ctx, object, status)).To(Succeed())
+
+		unrecorded, err := r.unrecordedSecrets(ctx, stale, []v1.Secret{*recorded, *pending, *leftover})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unrecorded).To(HaveLen(1))
+		Expect(unrecorded[0].Name).To(Equal(leftover.Name))
+	})
+
+	It("creates the recorded secret after a crash before its creation", func() {
+		r := newTestReconciler()
+		object := createTestToken(ctx, "crash")
+		key := types.NamespacedName{Namespace: object.Namespace, Name: object.Name}
+
+		// the name of the first secret was recorded, but the operator stopped
+		// before creating the secret
+		Expect(r.AddFinalizer(ctx, object)).To(Succeed())
+		name := secretNameFor(object, 1)
+		status := object.Status.DeepCopy()
+		status.Phase = phaseProvisioning
+		status.IssuedCount = 1
+		status.PendingSecretName = name
+		Expect(r.patchStatus(ctx, object, status)).To(Succeed())
+		Eventually(cachedVersion(object)).Should(Equal(object.ResourceVersion))
+		Eventually(func() error {
+			return mgr.GetClient().Get(ctx, key, &v1.ServiceAccount{})
+		}).Should(Succeed())
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		secret := &v1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: object.Namespace, Name: name}, secret)).To(Succeed())
+		Expect(v12.IsControlledBy(secret, object)).To(BeTrue())
+
+		// the recorded name is used rather than issuing under a new one
+		latest := &apiv1beta1.Token{}
+		Expect(k8sClient.Get(ctx, key, latest)).To(Succeed())
+		Expect(latest.Status.IssuedCount).To(Equal(int64(1)))
+		Expect(latest.Status.PendingSecretName).To(Equal(name))
+
+		secrets := &v1.SecretList{}
+		Expect(k8sClient.List(ctx, secrets, client.InNamespace(object.Namespace))).To(Succeed())
+		var issued []string
+		for _, secret := range secrets.Items {
+			if v12.IsControlledBy(&secret, object) {
+				issued = append(issued, secret.Name)
+			}
+		}
+		Expect(issued).To(ConsistOf(name))
+
+		// a second reconcile adopts the secret instead of issuing another
+		Eventually(func() error {
+			return mgr.GetClient().Get(ctx, types.NamespacedName{Namespace: object.Namespace, Name: name}, &v1.Secret{})
+		}).Should(Succeed())
+		Eventually(cachedVersion(latest)).Should(Equal(latest.ResourceVersion))
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, key, latest)).To(Succeed())
+		Expect(latest.Status.IssuedCount).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reconcileServiceAccount returns the service account of the object, creating
+// it if requested. A service account created for the object is kept in line
+// with the template. nil is returned if the service account does not exist.
+func (r *TokenReconciler) reconcileServiceAccount(ctx context.Context, object *apiv1beta1.Token) (*v1.ServiceAccount, error) {
+	reqLogger := log.FromContext(ctx)
+
+	key := types.NamespacedName{
+		Namespace: object.Namespace,
+		Name:      object.Spec.ServiceAccountName,
+	}
+
+	serviceAccount := &v1.ServiceAccount{}
+	if err := r.Get(ctx, key, serviceAccount); err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		if !object.Spec.CreateServiceAccount {
+			return nil, nil
+		}
+
+		serviceAccount = &v1.ServiceAccount{
+			ObjectMeta: v12.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			},
+		}
+		applyServiceAccountTemplate(serviceAccount, object.Spec.ServiceAccountTemplate)
+		if err := controllerutil.SetControllerReference(object, serviceAccount, r.Scheme); err != nil {
+			return nil, err
+		}
+
+		if err := r.Create(ctx, serviceAccount); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return nil, err
+			}
+			// the cache has not caught up with a service account created
+			// in an earlier reconcile or by someone else
+			if err := r.APIReader.Get(ctx, key, serviceAccount); err != nil {
+				return nil, err
+			}
+		} else {
+			reqLogger.Info("created service account", "name", serviceAccount.Name)
+			r.Recorder.Eventf(
+				object,
+				v1.EventTypeNormal,
+				reasonServiceAccountCreated,
+				"created service account %s",
+				serviceAccount.Name,
+			)
+			return serviceAccount, nil
+		}
+	}
+
+	if serviceAccount.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	// service accounts not created by the operator are left untouched
+	if !object.Spec.CreateServiceAccount || !v12.IsControlledBy(serviceAccount, object) {
+		return serviceAccount, nil
+	}
+
+	updated := serviceAccount.DeepCopy()
+	applyServiceAccountTemplate(updated, object.Spec.ServiceAccountTemplate)
+	if equality.Semantic.DeepEqual(serviceAccount, updated) {
+		return serviceAccount, nil
+	}
+
+	if err := r.Update(ctx, updated); err != nil {
+		reqLogger.Error(err, "failed to update service account", "name", serviceAccount.Name)
+		return nil, err
+	}
+	reqLogger.Info("updated service account", "name", serviceAccount.Name)
+
+	return updated, nil
+}
+
+// applyServiceAccountTemplate merges the labels and annotations of the template
+// into the service account and sets its image pull secrets
+func applyServiceAccountTemplate(serviceAccount *v1.ServiceAccount, template *apiv1beta1.ServiceAccountTemplate) {
+	if serviceAccount.Labels == nil {
+		serviceAccount.Labels = make(map[string]string)
+	}
+	serviceAccount.Labels[labelManagedBy] = managedBy
+
+	if template == nil {
+		return
+	}
+
+	for key, value := range template.Labels {
+		serviceAccount.Labels[key] = value
+	}
+
+	if len(template.Annotations) > 0 && serviceAccount.Annotations == nil {
+		serviceAccount.Annotations = make(map[string]string)
+	}
+	for key, value := range template.Annotations {
+		serviceAccount.Annotations[key] = value
+	}
+
+	serviceAccount.ImagePullSecrets = template.ImagePullSecrets
+}
+
+// orphanServiceAccount removes the owner reference to the object from the
+// service account created for it, so that it outlives the object
+func (r *TokenReconciler) orphanServiceAccount(ctx context.Context, object *apiv1beta1.Token) error {
+	reqLogger := log.FromContext(ctx)
+
+	serviceAccount := &v1.ServiceAccount{}
+	if err := r.Get(
+		ctx,
+		types.NamespacedName{
+			Namespace: object.Namespace,
+			Name:      object.Spec.ServiceAccountName,
+		},
+		serviceAccount,
+	); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		reqLogger.Error(err, "failed to get service account")
+		return err
+	}
+
+	if !v12.IsControlledBy(serviceAccount, object) {
+		return nil
+	}
+
+	patch := client.MergeFrom(serviceAccount.DeepCopy())
+	var ownerReferences []v12.OwnerReference
+	for _, ownerReference := range serviceAccount.OwnerReferences {
+		if ownerReference.UID != object.UID {
+			ownerReferences = append(ownerReferences, ownerReference)
+		}
+	}
+	serviceAccount.OwnerReferences = ownerReferences
+
+	if err := r.Patch(ctx, serviceAccount, patch, client.FieldOwner(fieldOwner)); err != nil && !errors.IsNotFound(err) {
+		reqLogger.Error(err, "failed to orphan service account", "name", serviceAccount.Name)
+		return err
+	}
+	reqLogger.Info("orphaned service account", "name", serviceAccount.Name)
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tokenFingerprint returns the SHA-256 hash of the token held in the secret
+func tokenFingerprint(secret *v1.Secret) string {
+	token := secret.Data[v1.ServiceAccountTokenKey]
+	if len(token) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(token)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// secretStatus describes an existing secret issued for the object
+func secretStatus(object *apiv1beta1.Token, secret, current *v1.Secret) apiv1beta1.TokenSecretStatus {
+	status := apiv1beta1.TokenSecretStatus{
+		Name:        secret.Name,
+		State:       apiv1beta1.SecretStateRetiring,
+		IssuedAt:    secret.CreationTimestamp,
+		Fingerprint: tokenFingerprint(secret),
+	}
+
+	if rotateAt := rotationTime(object, secret); !rotateAt.IsZero() {
+		status.RotatesAt = &v12.Time{Time: rotateAt}
+	}
+
+	if deleteAt, ok := secretDeleteAt(object, secret); ok {
+		status.DeleteAt = &v12.Time{Time: deleteAt}
+	}
+
+	if current != nil && secret.Name == current.Name {
+		status.State = apiv1beta1.SecretStateActive
+	} else if expiry, ok := secretExpiry(object, secret); ok && time.Since(expiry) > 0 {
+		status.State = apiv1beta1.SecretStateExpired
+	}
+
+	return status
+}
+
+// secretStatuses merges the recorded secrets with the observed ones. Secrets
+// that no longer exist are kept as expired entries, bounded by
+// maxExpiredSecretStatuses, so that past tokens can still be traced. The
+// pending secret is reported separately and not listed until it is promoted.
+func secretStatuses(
+	object *apiv1beta1.Token,
+	recorded []apiv1beta1.TokenSecretStatus,
+	current, pending *v1.Secret,
+	secrets []v1.Secret,
+) []apiv1beta1.TokenSecretStatus {
+	observed := make(map[string]*v1.Secret)
+	for i := range secrets {
+		observed[secrets[i].Name] = &secrets[i]
+	}
+	if current != nil {
+		observed[current.Name] = current
+	}
+	if pending != nil {
+		delete(observed, pending.Name)
+	}
+
+	var statuses, expired []apiv1beta1.TokenSecretStatus
+	for _, status := range recorded {
+		if secret, ok := observed[status.Name]; ok {
+			statuses = append(statuses, secretStatus(object, secret, current))
+			delete(observed, status.Name)
+			continue
+		}
+
+		status.State = apiv1beta1.SecretStateExpired
+		expired = append(expired, status)
+	}
+
+	for _, secret := range observed {
+		statuses = append(statuses, secretStatus(object, secret, current))
+	}
+
+	sortSecretStatuses(expired)
+	if len(expired) > maxExpiredSecretStatuses {
+		expired = expired[len(expired)-maxExpiredSecretStatuses:]
+	}
+
+	statuses = append(statuses, expired...)
+	sortSecretStatuses(statuses)
+	return statuses
+}
+
+// sortSecretStatuses orders secrets from oldest to newest
+func sortSecretStatuses(statuses []apiv1beta1.TokenSecretStatus) {
+	sort.Slice(statuses, func(i, j int) bool {
+		if !statuses[i].IssuedAt.Equal(&statuses[j].IssuedAt) {
+			return statuses[i].IssuedAt.Before(&statuses[j].IssuedAt)
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+}
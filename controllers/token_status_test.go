@@ -0,0 +1,151 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSecretStatuses(t *testing.T) {
+	issuedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	secret := func(name string, age time.Duration, annotations map[string]string) v1.Secret {
+		return v1.Secret{
+			ObjectMeta: v12.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: v12.Time{Time: issuedAt.Add(age)},
+				Annotations:       annotations,
+			},
+			Data: map[string][]byte{v1.ServiceAccountTokenKey: []byte(name)},
+		}
+	}
+	recorded := func(name string, age time.Duration) apiv1beta1.TokenSecretStatus {
+		return apiv1beta1.TokenSecretStatus{
+			Name:     name,
+			State:    apiv1beta1.SecretStateRetiring,
+			IssuedAt: v12.Time{Time: issuedAt.Add(age)},
+		}
+	}
+	states := func(statuses []apiv1beta1.TokenSecretStatus) []string {
+		var states []string
+		for _, status := range statuses {
+			states = append(states, fmt.Sprintf("%s:%s", status.Name, status.State))
+		}
+		return states
+	}
+
+	object := &apiv1beta1.Token{}
+	expired := map[string]string{
+		annotationExpirationTimestamp: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+	}
+
+	t.Run("states of observed secrets", func(t *testing.T) {
+		previous := secret("previous", time.Hour, nil)
+		stale := secret("stale", 0, expired)
+		current := secret("current", 2*time.Hour, nil)
+		pending := secret("pending", 3*time.Hour, nil)
+
+		statuses := secretStatuses(
+			object,
+			nil,
+			&current,
+			&pending,
+			[]v1.Secret{pending, current, previous, stale},
+		)
+
+		want := []string{"stale:expired", "previous:retiring", "current:active"}
+		if got := states(statuses); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("secretStatuses() = %v, want %v", got, want)
+		}
+		if statuses[2].Fingerprint != tokenFingerprint(&current) || len(statuses[2].Fingerprint) == 0 {
+			t.Errorf("fingerprint = %q, want %q", statuses[2].Fingerprint, tokenFingerprint(&current))
+		}
+	})
+
+	t.Run("deleted secrets are kept as expired", func(t *testing.T) {
+		current := secret("current", time.Hour, nil)
+		deleted := recorded("deleted", 0)
+		deleted.Fingerprint = "sha256:deleted"
+
+		statuses := secretStatuses(
+			object,
+			[]apiv1beta1.TokenSecretStatus{deleted, recorded("current", time.Hour)},
+			&current,
+			nil,
+			nil,
+		)
+
+		want := []string{"deleted:expired", "current:active"}
+		if got := states(statuses); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("secretStatuses() = %v, want %v", got, want)
+		}
+		if statuses[0].Fingerprint != deleted.Fingerprint {
+			t.Errorf("fingerprint = %q, want %q", statuses[0].Fingerprint, deleted.Fingerprint)
+		}
+	})
+
+	t.Run("expired entries are bounded", func(t *testing.T) {
+		var history []apiv1beta1.TokenSecretStatus
+		for i := 0; i < maxExpiredSecretStatuses+5; i++ {
+			history = append(history, recorded(fmt.Sprintf("deleted-%02d", i), time.Duration(i)*time.Minute))
+		}
+		current := secret("current", time.Hour, nil)
+
+		statuses := secretStatuses(object, history, &current, nil, nil)
+
+		if len(statuses) != maxExpiredSecretStatuses+1 {
+			t.Fatalf("len(secretStatuses()) = %d, want %d", len(statuses), maxExpiredSecretStatuses+1)
+		}
+		if statuses[0].Name != "deleted-05" {
+			t.Errorf("oldest entry = %s, want deleted-05", statuses[0].Name)
+		}
+		if last := statuses[len(statuses)-1]; last.Name != "current" || last.State != apiv1beta1.SecretStateActive {
+			t.Errorf("newest entry = %s:%s, want current:active", last.Name, last.State)
+		}
+	})
+
+	t.Run("rotation and deletion times", func(t *testing.T) {
+		period := int64(3600)
+		grace := int64(600)
+		object := &apiv1beta1.Token{
+			Spec: apiv1beta1.TokenSpec{
+				RotationPeriodSeconds:      &period,
+				DeletionGracePeriodSeconds: &grace,
+			},
+		}
+		current := secret("current", 0, nil)
+
+		statuses := secretStatuses(object, nil, &current, nil, nil)
+
+		if len(statuses) != 1 {
+			t.Fatalf("len(secretStatuses()) = %d, want 1", len(statuses))
+		}
+		rotatesAt := issuedAt.Add(time.Hour)
+		if statuses[0].RotatesAt == nil || !statuses[0].RotatesAt.Time.Equal(rotatesAt) {
+			t.Errorf("rotatesAt = %v, want %s", statuses[0].RotatesAt, rotatesAt)
+		}
+		deleteAt := rotatesAt.Add(10 * time.Minute)
+		if statuses[0].DeleteAt == nil || !statuses[0].DeleteAt.Time.Equal(deleteAt) {
+			t.Errorf("deleteAt = %v, want %s", statuses[0].DeleteAt, deleteAt)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// suspension returns the reason and message of a suspension of the issuance
+// of new tokens for the object, which are empty if tokens are issued
+func (r *TokenReconciler) suspension(object *apiv1beta1.Token) (string, string) {
+	switch {
+	case object.Spec.Suspend:
+		return reasonTokenSuspended, "token issuance is suspended by spec.suspend"
+	case r.FreezeRotation:
+		return reasonRotationFrozen, "token issuance is frozen for all tokens by the operator"
+	default:
+		return "", ""
+	}
+}
+
+// rotationDeferred checks if the object already reported a deferred issuance
+func rotationDeferred(object *apiv1beta1.Token) bool {
+	condition := meta.FindStatusCondition(object.Status.Conditions, conditionTypeSuspended)
+	return condition != nil && condition.Reason == reasonRotationDeferred
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apiv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// rotationStrategy returns the rotation strategy of the object, which
+// defaults to overlapping the previous token for the grace period
+func rotationStrategy(object *apiv1beta1.Token) apiv1beta1.RotationStrategy {
+	if object.Spec.Rotation == nil || len(object.Spec.Rotation.Strategy) == 0 {
+		return apiv1beta1.RotationStrategyOverlap
+	}
+	return object.Spec.Rotation.Strategy
+}
+
+// verificationTimedOut checks if the pending token has been failing
+// verification for longer than the provisioning timeout
+func verificationTimedOut(status *apiv1beta1.TokenStatus, timeout time.Duration) bool {
+	return status.PendingVerificationFailedAt != nil &&
+		time.Since(status.PendingVerificationFailedAt.Time) > timeout
+}
+
+// verifyToken validates the token in the secret with a TokenReview for the
+// audiences of the object. It returns the reason the token failed validation,
+// which is empty if the token authenticates as the service account.
+func (r *TokenReconciler) verifyToken(ctx context.Context, object *apiv1beta1.Token, secret *v1.Secret) (string, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     string(secret.Data[v1.ServiceAccountTokenKey]),
+			Audiences: object.Spec.Audiences,
+		},
+	}
+	if err := r.Create(ctx, review); err != nil {
+		return "", err
+	}
+
+	if !review.Status.Authenticated {
+		if len(review.Status.Error) > 0 {
+			return fmt.Sprintf("token in secret %s failed to authenticate: %s", secret.Name, review.Status.Error), nil
+		}
+		return fmt.Sprintf("token in secret %s failed to authenticate", secret.Name), nil
+	}
+
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", object.Namespace, object.Spec.ServiceAccountName)
+	if review.Status.User.Username != username {
+		return fmt.Sprintf(
+			"token in secret %s authenticated as %s instead of %s",
+			secret.Name,
+			review.Status.User.Username,
+			username,
+		), nil
+	}
+
+	return "", nil
+}
@@ -3,9 +3,11 @@ module github.com/kubetrail/serviceaccount-operator
 go 1.16
 
 require (
-	github.com/google/uuid v1.1.2
+	github.com/go-logr/logr v0.4.0
+	github.com/google/uuid v1.1.2 // indirect
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.15.0
+	github.com/prometheus/client_golang v1.11.0
 	go.uber.org/zap v1.19.0
 	k8s.io/api v0.22.1
 	k8s.io/apimachinery v0.22.1
@@ -0,0 +1,309 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron parses standard five field cron expressions and computes
+// their activation times
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day fields were unrestricted,
+	// since a day matches either day field when both are restricted
+	domStar, dowStar bool
+}
+
+// field describes the range and names of a cron field
+type field struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// day of week accepts 7 as an alias for Sunday, which is folded into 0
+	// once the field is parsed, so that ranges such as 5-7 work
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are the supported shorthands for common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxYears bounds the search for the next activation, so that expressions
+// that never match, such as 30 February, do not loop forever
+const maxYears = 5
+
+// Parse parses a cron expression with the fields minute, hour, day of month,
+// month and day of week. Fields accept *, values, ranges, lists and steps,
+// and month and day of week also accept three letter names. The descriptors
+// @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are
+// supported as well.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, found %d", spec, len(fields))
+	}
+
+	schedule := &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+
+	var err error
+	for i, target := range []struct {
+		bits  *uint64
+		field field
+	}{
+		{&schedule.minute, minuteField},
+		{&schedule.hour, hourField},
+		{&schedule.dom, domField},
+		{&schedule.month, monthField},
+		{&schedule.dow, dowField},
+	} {
+		if *target.bits, err = parseField(fields[i], target.field); err != nil {
+			return nil, err
+		}
+	}
+
+	// 7 is an alias for Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+
+	return schedule, nil
+}
+
+// parseField parses a comma separated list of ranges into a bit set
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		partBits, err := parseRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= partBits
+	}
+	return bits, nil
+}
+
+// parseRange parses a single value, range or wildcard with an optional step
+func parseRange(value string, f field) (uint64, error) {
+	rangeAndStep := strings.SplitN(value, "/", 2)
+	lowAndHigh := strings.SplitN(rangeAndStep[0], "-", 2)
+
+	var low, high uint
+	var err error
+	switch {
+	case lowAndHigh[0] == "*" || lowAndHigh[0] == "?":
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid %s range %q", f.name, value)
+		}
+		low, high = f.min, f.max
+	default:
+		if low, err = parseValue(lowAndHigh[0], f); err != nil {
+			return 0, err
+		}
+		high = low
+		if len(lowAndHigh) > 1 {
+			if high, err = parseValue(lowAndHigh[1], f); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	step := uint(1)
+	if len(rangeAndStep) > 1 {
+		parsed, err := strconv.ParseUint(rangeAndStep[1], 10, 8)
+		if err != nil || parsed == 0 {
+			return 0, fmt.Errorf("invalid %s step %q", f.name, value)
+		}
+		step = uint(parsed)
+		// a value with a step runs from the value to the end of the range
+		if len(lowAndHigh) == 1 && lowAndHigh[0] != "*" && lowAndHigh[0] != "?" {
+			high = f.max
+		}
+	}
+
+	if low > high {
+		return 0, fmt.Errorf("invalid %s range %q, start is after end", f.name, value)
+	}
+
+	var bits uint64
+	for i := low; i <= high; i += step {
+		bits |= 1 << i
+	}
+	return bits, nil
+}
+
+// parseValue parses a number or name within the range of the field
+func parseValue(value string, f field) (uint, error) {
+	if number, ok := f.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", f.name, value)
+	}
+
+	number := uint(parsed)
+	if number < f.min || number > f.max {
+		return 0, fmt.Errorf("%s value %d is out of range %d-%d", f.name, number, f.min, f.max)
+	}
+	return number, nil
+}
+
+// Next returns the first activation strictly after t in the location of t,
+// or the zero time if the expression does not activate within five years
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// start at the beginning of the next minute
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// clocks moving backwards can map the next hour onto the current one
+			if !next.After(t) {
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// MinInterval returns the shortest wall clock time between two consecutive
+// activations, disregarding clock changes, or zero if the expression does not
+// activate at least twice within eight years
+func (s *Schedule) MinInterval() time.Duration {
+	// activations within a day in minutes since midnight
+	var minutes []int
+	for hour := 0; hour < 24; hour++ {
+		if s.hour&(1<<uint(hour)) == 0 {
+			continue
+		}
+		for minute := 0; minute < 60; minute++ {
+			if s.minute&(1<<uint(minute)) != 0 {
+				minutes = append(minutes, hour*60+minute)
+			}
+		}
+	}
+	if len(minutes) == 0 {
+		return 0
+	}
+
+	interval := 0
+	for i := 1; i < len(minutes); i++ {
+		if gap := minutes[i] - minutes[i-1]; interval == 0 || gap < interval {
+			interval = gap
+		}
+	}
+
+	// the last activation of a day is followed by the first activation of
+	// the next day that matches, which is found by scanning a span long
+	// enough to cover leap days
+	if days := s.minDayGap(); days > 0 {
+		gap := days*24*60 - minutes[len(minutes)-1] + minutes[0]
+		if interval == 0 || gap < interval {
+			interval = gap
+		}
+	}
+
+	return time.Duration(interval) * time.Minute
+}
+
+// minDayGap returns the fewest days between two consecutive days matching
+// the expression within eight years, or zero if fewer than two days match
+func (s *Schedule) minDayGap() int {
+	start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	gap, last := 0, -1
+	for day := 0; day < 8*366; day++ {
+		t := start.AddDate(0, 0, day)
+		if s.month&(1<<uint(t.Month())) == 0 || !s.dayMatches(t) {
+			continue
+		}
+		if last >= 0 && (gap == 0 || day-last < gap) {
+			gap = day - last
+			if gap == 1 {
+				return gap
+			}
+		}
+		last = day
+	}
+	return gap
+}
+
+// dayMatches checks the day fields, which match if either matches when both
+// are restricted
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
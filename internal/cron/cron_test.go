@@ -0,0 +1,242 @@
+/*
+Copyright 2022 kubetrail.io authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "@daily"},
+		{spec: "@weekly"},
+		{spec: "0 0 * * 5-7"},
+		{spec: "0 0 * * 7"},
+		{spec: "0 0 * * 0-7/2"},
+		{spec: "*/15 9-17 * * mon-fri"},
+		{spec: "0 0 1,15 * *"},
+		{spec: "0 12 ? jan-mar SUN"},
+		{spec: "30 2 31 2 *"},
+		{spec: "", wantErr: true},
+		{spec: "* * * *", wantErr: true},
+		{spec: "* * * * * *", wantErr: true},
+		{spec: "@hourly"},
+		{spec: "@minutely", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* 24 * * *", wantErr: true},
+		{spec: "* * 0 * *", wantErr: true},
+		{spec: "* * 32 * *", wantErr: true},
+		{spec: "* * * 13 *", wantErr: true},
+		{spec: "* * * * 8", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "a * * * *", wantErr: true},
+		{spec: "* * * foo *", wantErr: true},
+		{spec: "1-2-3 * * * *", wantErr: true},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", test.spec, err, test.wantErr)
+		}
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	tests := []struct {
+		spec string
+		want time.Duration
+	}{
+		{spec: "* * * * *", want: time.Minute},
+		{spec: "*/15 * * * *", want: 15 * time.Minute},
+		{spec: "0,50 * * * *", want: 10 * time.Minute},
+		{spec: "@hourly", want: time.Hour},
+		{spec: "0 9-17 * * *", want: time.Hour},
+		{spec: "0 0,23 * * *", want: time.Hour},
+		{spec: "30 23 * * *", want: 24 * time.Hour},
+		{spec: "0 0 * * 5-7", want: 24 * time.Hour},
+		{spec: "@weekly", want: 7 * 24 * time.Hour},
+		{spec: "0 0,23 * * mon", want: 23 * time.Hour},
+		{spec: "0 0 1,15 * *", want: 14 * 24 * time.Hour},
+		{spec: "0 0 29 2 *", want: (4*365 + 1) * 24 * time.Hour},
+		{spec: "0 0 31 2 *"},
+	}
+
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.spec, err)
+		}
+		if got := schedule.MinInterval(); got != test.want {
+			t.Errorf("MinInterval(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	load := func(name string) *time.Location {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location
+	}
+	utc := time.UTC
+	berlin := load("Europe/Berlin")
+	newYork := load("America/New_York")
+	kolkata := load("Asia/Kolkata")
+	adelaide := load("Australia/Adelaide")
+	lordHowe := load("Australia/Lord_Howe")
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "later the same day",
+			spec: "0 3 * * *",
+			from: time.Date(2026, 10, 17, 1, 0, 0, 0, utc),
+			want: time.Date(2026, 10, 17, 3, 0, 0, 0, utc),
+		},
+		{
+			name: "strictly after the given time",
+			spec: "0 3 * * *",
+			from: time.Date(2026, 10, 17, 3, 0, 0, 0, utc),
+			want: time.Date(2026, 10, 18, 3, 0, 0, 0, utc),
+		},
+		{
+			name: "seconds are truncated",
+			spec: "* * * * *",
+			from: time.Date(2026, 10, 17, 3, 0, 59, 999, utc),
+			want: time.Date(2026, 10, 17, 3, 1, 0, 0, utc),
+		},
+		{
+			name: "next year",
+			spec: "@yearly",
+			from: time.Date(2026, 10, 17, 0, 0, 0, 0, utc),
+			want: time.Date(2027, 1, 1, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "leap day",
+			spec: "0 0 29 2 *",
+			from: time.Date(2026, 10, 17, 0, 0, 0, 0, utc),
+			want: time.Date(2028, 2, 29, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "day that never occurs",
+			spec: "0 0 31 2 *",
+			from: time.Date(2026, 10, 17, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "day of week range ending in sunday",
+			spec: "0 0 * * 5-7",
+			from: time.Date(2026, 10, 18, 12, 0, 0, 0, utc),
+			want: time.Date(2026, 10, 23, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "sunday as 7",
+			spec: "0 0 * * 7",
+			from: time.Date(2026, 10, 17, 12, 0, 0, 0, utc),
+			want: time.Date(2026, 10, 18, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "either day field when both are restricted",
+			spec: "0 0 13 * fri",
+			from: time.Date(2026, 10, 10, 0, 0, 0, 0, utc),
+			want: time.Date(2026, 10, 13, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "day of month only when day of week is unrestricted",
+			spec: "0 0 13 * *",
+			from: time.Date(2026, 10, 14, 0, 0, 0, 0, utc),
+			want: time.Date(2026, 11, 13, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "time that is skipped when clocks go forward",
+			spec: "30 2 * * *",
+			from: time.Date(2026, 3, 28, 12, 0, 0, 0, berlin),
+			want: time.Date(2026, 3, 30, 2, 30, 0, 0, berlin),
+		},
+		{
+			name: "hourly across clocks going forward",
+			spec: "0 * * * *",
+			from: time.Date(2026, 3, 8, 1, 30, 0, 0, newYork),
+			want: time.Date(2026, 3, 8, 7, 0, 0, 0, utc),
+		},
+		{
+			name: "time that repeats when clocks go back",
+			spec: "30 1 * * *",
+			from: time.Date(2026, 11, 1, 0, 0, 0, 0, newYork),
+			want: time.Date(2026, 11, 1, 5, 30, 0, 0, utc),
+		},
+		{
+			name: "hourly across clocks going back",
+			spec: "0 * * * *",
+			from: time.Date(2026, 11, 1, 5, 0, 0, 0, utc),
+			want: time.Date(2026, 11, 1, 6, 0, 0, 0, utc),
+		},
+		{
+			name: "half hour offset",
+			spec: "0 9 * * *",
+			from: time.Date(2026, 10, 17, 0, 0, 0, 0, utc).In(kolkata),
+			want: time.Date(2026, 10, 17, 3, 30, 0, 0, utc),
+		},
+		{
+			name: "half hour offset when clocks go forward",
+			spec: "0 3 * * *",
+			from: time.Date(2026, 10, 3, 12, 0, 0, 0, adelaide),
+			want: time.Date(2026, 10, 4, 3, 0, 0, 0, adelaide),
+		},
+		{
+			name: "half hour shift when clocks go forward",
+			spec: "15 2 * * *",
+			from: time.Date(2026, 10, 3, 12, 0, 0, 0, lordHowe),
+			want: time.Date(2026, 10, 5, 2, 15, 0, 0, lordHowe),
+		},
+		{
+			name: "after a half hour shift when clocks go forward",
+			spec: "45 2 * * *",
+			from: time.Date(2026, 10, 3, 12, 0, 0, 0, lordHowe),
+			want: time.Date(2026, 10, 4, 2, 45, 0, 0, lordHowe),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := Parse(test.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.spec, err)
+			}
+			got := schedule.Next(test.from)
+			if !got.Equal(test.want) {
+				t.Errorf("Next(%v) = %v, want %v", test.from, got, test.want)
+			}
+			if !got.IsZero() && got.Location() != test.from.Location() {
+				t.Errorf("Next(%v) location = %v, want %v", test.from, got.Location(), test.from.Location())
+			}
+		})
+	}
+}
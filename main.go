@@ -18,19 +18,29 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	// Embed the time zone database, since the distroless base image does not
+	// ship one, so that rotation schedules can use IANA time zones.
+	_ "time/tzdata"
+
 	serviceaccountv1beta1 "github.com/kubetrail/serviceaccount-operator/api/v1beta1"
 	"github.com/kubetrail/serviceaccount-operator/controllers"
 	"go.uber.org/zap/zapcore"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	//+kubebuilder:scaffold:imports
@@ -52,11 +62,26 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var provisioningTimeout time.Duration
+	var apiServerURL string
+	var freezeRotation bool
+	var issuanceBudget int
+	var issuanceBudgetWindow time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&provisioningTimeout, "token-provisioning-timeout", 2*time.Minute,
+		"The time to wait for a secret to be populated with a token before reporting the token as degraded.")
+	flag.StringVar(&apiServerURL, "api-server-url", "",
+		"The API server URL written into generated kubeconfigs that do not specify a server.")
+	flag.BoolVar(&freezeRotation, "freeze-rotation", false,
+		"Suspend the issuance of new tokens for all tokens, while secrets past their grace period are still deleted.")
+	flag.IntVar(&issuanceBudget, "issuance-budget", 0,
+		"The number of tokens issued per issuance budget window, beyond which overdue rotations are spread out. Zero does not limit issuances.")
+	flag.DurationVar(&issuanceBudgetWindow, "issuance-budget-window", time.Minute,
+		"The window the issuance budget applies to.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -66,22 +91,50 @@ func main() {
 	// ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 	setupLogger()
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	config := ctrl.GetConfigOrDie()
+
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "6e1ce403.kubetrail.io",
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&v1.Secret{}: {Label: controllers.SecretSelector()},
+			},
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	rootCA, err := loadRootCA(config)
+	if err != nil {
+		setupLog.Error(err, "unable to load cluster CA")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.TokenReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		APIReader:            mgr.GetAPIReader(),
+		Recorder:             mgr.GetEventRecorderFor("token-controller"),
+		Clientset:            clientset,
+		RootCA:               rootCA,
+		ProvisioningTimeout:  provisioningTimeout,
+		APIServerURL:         apiServerURL,
+		FreezeRotation:       freezeRotation,
+		IssuanceBudget:       issuanceBudget,
+		IssuanceBudgetWindow: issuanceBudgetWindow,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Token")
 		os.Exit(1)
@@ -90,6 +143,18 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Token")
 		os.Exit(1)
 	}
+	if err = (&controllers.ClusterTokenReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("clustertoken-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterToken")
+		os.Exit(1)
+	}
+	if err = (&serviceaccountv1beta1.ClusterToken{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterToken")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -134,3 +199,17 @@ func setupLogger() {
 		),
 	)
 }
+
+// loadRootCA returns the cluster CA bundle from the rest config. Issued
+// token secrets carry the bundle, so a config without one, such as one that
+// skips TLS verification, is refused.
+func loadRootCA(config *rest.Config) ([]byte, error) {
+	tlsConfig := rest.CopyConfig(config)
+	if err := rest.LoadTLSFiles(tlsConfig); err != nil {
+		return nil, err
+	}
+	if len(tlsConfig.CAData) == 0 {
+		return nil, fmt.Errorf("rest config has no cluster CA bundle")
+	}
+	return tlsConfig.CAData, nil
+}